@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	ingress "github.com/mudler/eirini-ingress/extensions/ingress"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	exportCmd.Flags().StringP("filename", "f", "-", "Archive to write, '-' writes stdout")
+	importCmd.Flags().StringP("filename", "f", "", "Archive to read, '-' reads stdin")
+	importCmd.Flags().String("namespace-map", "", "Namespaces to import the resources in ( json form '{ 'eirini': 'cf-apps' }' )")
+	importCmd.Flags().String("conflict", ingress.ConflictFail, "Policy for the existing resources, either 'skip', 'overwrite' or 'fail'")
+	importCmd.MarkFlagRequired("filename")
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(importCmd)
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export -f archive.json",
+	Short: "Write the Services and Ingresses generated in the namespace, and its route table, to an archive",
+	Run: func(cmd *cobra.Command, args []string) {
+		file, _ := cmd.Flags().GetString("filename")
+
+		ext, err := newPodWatcher()
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		client, err := newClientSet()
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		archive, err := ext.Export(client, viper.GetString("namespace"))
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		data, err := json.MarshalIndent(archive, "", "  ")
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+
+		if file == "-" {
+			fmt.Println(string(data))
+			return
+		}
+		if err := ioutil.WriteFile(file, append(data, '\n'), 0644); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		fmt.Printf("Exported %d services, %d ingresses and %d routes to %s\n",
+			len(archive.Services), len(archive.Ingresses), len(archive.Routes), file)
+	},
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import -f archive.json",
+	Short: "Recreate the Services and Ingresses of an archive",
+	Run: func(cmd *cobra.Command, args []string) {
+		file, _ := cmd.Flags().GetString("filename")
+		policy, _ := cmd.Flags().GetString("conflict")
+		namespaceMap, _ := cmd.Flags().GetString("namespace-map")
+
+		var namespaces = make(map[string]string)
+		if namespaceMap != "" {
+			if err := json.Unmarshal([]byte(namespaceMap), &namespaces); err != nil {
+				fmt.Println("invalid namespace map:", err.Error())
+				os.Exit(1)
+			}
+		}
+
+		var data []byte
+		var err error
+		if file == "-" {
+			data, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			data, err = ioutil.ReadFile(file)
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		archive := &ingress.RouteArchive{}
+		if err := json.Unmarshal(data, archive); err != nil {
+			fmt.Println("invalid archive:", err.Error())
+			os.Exit(1)
+		}
+
+		client, err := newClientSet()
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		result, err := ingress.Import(client, archive, namespaces, policy)
+		for _, r := range result.Created {
+			fmt.Println("Created", r)
+		}
+		for _, r := range result.Updated {
+			fmt.Println("Updated", r)
+		}
+		for _, r := range result.Skipped {
+			fmt.Println("Skipped", r)
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	},
+}
@@ -0,0 +1,243 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	eirinix "github.com/SUSE/eirinix"
+	ingress "github.com/mudler/eirini-ingress/extensions/ingress"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+// newManager returns an eirinix manager for the namespace and kubeconfig flags
+func newManager() eirinix.Manager {
+	filter := false
+	return eirinix.NewManager(eirinix.ManagerOptions{
+		Namespace:           viper.GetString("namespace"),
+		KubeConfig:          viper.GetString("kubeconfig"),
+		OperatorFingerprint: "eirini-ingress",
+		FilterEiriniApps:    &filter,
+	})
+}
+
+// kubeConfig returns the configuration of the cluster of the kubeconfig flag, or the one
+// running the command
+func kubeConfig() (*rest.Config, error) {
+	return newManager().GetKubeConnection()
+}
+
+// newClientSet returns a clientset for the cluster, see kubeConfig
+func newClientSet() (kubernetes.Interface, error) {
+	config, err := kubeConfig()
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(config)
+}
+
+// newPodWatcher returns a PodWatcher generating the resources as configured by the root flags.
+// The components running against the cluster are left to the caller.
+func newPodWatcher() (*ingress.PodWatcher, error) {
+	var resourceLabels = make(map[string]string)
+	var resourceAnnotations = make(map[string]string)
+	var domainSecrets = make(map[string]string)
+	var credhubCertificates = make(map[string]string)
+	var routeServices = make(map[string]string)
+
+	json.Unmarshal([]byte(viper.GetString("annotations")), &resourceAnnotations)
+	json.Unmarshal([]byte(viper.GetString("labels")), &resourceLabels)
+	json.Unmarshal([]byte(viper.GetString("tls-secrets")), &domainSecrets)
+	json.Unmarshal([]byte(viper.GetString("credhub-certificates")), &credhubCertificates)
+	json.Unmarshal([]byte(viper.GetString("route-services")), &routeServices)
+
+	ext := ingress.NewPodWatcher(resourceLabels, resourceAnnotations)
+	ext.TLS = viper.GetBool("tls")
+	ext.RouteServices = routeServices
+	ext.InstanceServices = viper.GetBool("instance-services")
+	ext.AdoptUnlabeled = viper.GetBool("adopt-unlabeled")
+
+	// Domains served from CredHub use a shared secret, named after the domain if not mapped already
+	if ext.TLS && viper.GetString("credhub-url") != "" {
+		for domain := range credhubCertificates {
+			if _, ok := domainSecrets[domain]; !ok {
+				domainSecrets[domain] = ingress.CredHubSecretName(domain)
+			}
+		}
+	}
+	ext.TLSSecrets = domainSecrets
+
+	switch mode := viper.GetString("external-dns"); mode {
+	case "":
+	case ingress.ExternalDNSAnnotations, ingress.ExternalDNSEndpoints:
+		var targets []string
+		if t := viper.GetString("external-dns-targets"); t != "" {
+			targets = strings.Split(t, ",")
+		}
+		ext.ExternalDNS = ingress.NewExternalDNS(mode, targets, viper.GetInt64("external-dns-ttl"))
+	default:
+		return nil, fmt.Errorf("invalid ExternalDNS mode: %s", mode)
+	}
+	return ext, nil
+}
+
+// setupAppComponents sets the components of the watcher acting on every app as configured by the
+// root flags: the secret replicator, the self-signed CA and the certificate monitor, which emits
+// its events with the recorder. Their periodic runs are left to the caller.
+func setupAppComponents(ext *ingress.PodWatcher, recorder record.EventRecorder) {
+	if !ext.TLS {
+		return
+	}
+
+	var replicatedSecrets = make(map[string]string)
+	json.Unmarshal([]byte(viper.GetString("replicate-secrets")), &replicatedSecrets)
+	if len(replicatedSecrets) != 0 {
+		ext.Replicator = ingress.NewSecretReplicator(replicatedSecrets)
+	}
+	if viper.GetBool("self-signed") {
+		ext.CA = ingress.NewSelfSignedCA(viper.GetString("namespace"), viper.GetString("ca-secret"))
+		ext.CA.Validity = viper.GetDuration("cert-validity")
+		ext.CA.RenewBefore = ext.CA.Validity / 3
+	}
+	if viper.GetBool("monitor-certificates") {
+		ext.Monitor = ingress.NewCertificateMonitor(recorder)
+		ext.Monitor.WarnBefore = viper.GetDuration("cert-warn-before")
+	}
+}
+
+// readPods decodes the pods of the manifest files ("-" reads stdin). Files can contain multiple
+// YAML or JSON documents, and lists such as the output of `kubectl get pods -o yaml`.
+// Pods without namespace get the default one, other objects are skipped.
+func readPods(files []string, namespace string) ([]corev1.Pod, error) {
+	pods := []corev1.Pod{}
+	for _, file := range files {
+		var r io.Reader
+		if file == "-" {
+			r = os.Stdin
+		} else {
+			f, err := os.Open(file)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			r = f
+		}
+
+		decoder := yaml.NewYAMLOrJSONDecoder(r, 4096)
+		for {
+			obj := map[string]interface{}{}
+			if err := decoder.Decode(&obj); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("%s: %s", file, err.Error())
+			}
+
+			items := []interface{}{obj}
+			if list, ok := obj["items"].([]interface{}); ok && strings.HasSuffix(fmt.Sprint(obj["kind"]), "List") {
+				items = list
+			}
+			for _, item := range items {
+				u, ok := item.(map[string]interface{})
+				if !ok || u["kind"] != "Pod" {
+					continue
+				}
+				var pod corev1.Pod
+				if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u, &pod); err != nil {
+					return nil, fmt.Errorf("%s: %s", file, err.Error())
+				}
+				if pod.GetNamespace() == "" {
+					pod.SetNamespace(namespace)
+				}
+				pods = append(pods, pod)
+			}
+		}
+	}
+	return pods, nil
+}
+
+// printObjects writes the objects as YAML documents, or as a JSON List
+func printObjects(w io.Writer, format string, objects []runtime.Object) error {
+	for _, obj := range objects {
+		if gvks, _, err := scheme.Scheme.ObjectKinds(obj); err == nil && len(gvks) != 0 {
+			obj.GetObjectKind().SetGroupVersionKind(gvks[0])
+		}
+	}
+
+	switch format {
+	case "json":
+		list := map[string]interface{}{"apiVersion": "v1", "kind": "List", "items": objects}
+		data, err := json.MarshalIndent(list, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case "yaml":
+		for i, obj := range objects {
+			data, err := sigsyaml.Marshal(obj)
+			if err != nil {
+				return err
+			}
+			if i != 0 {
+				fmt.Fprintln(w, "---")
+			}
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid output format: %s", format)
+	}
+}
+
+// requiredPermissions returns the permissions needed by the features enabled with the root flags
+func requiredPermissions() []ingress.Permission {
+	var replicatedSecrets = make(map[string]string)
+	json.Unmarshal([]byte(viper.GetString("replicate-secrets")), &replicatedSecrets)
+	return ingress.RequiredPermissions(ingress.Features{
+		Namespace:           viper.GetString("namespace"),
+		TLS:                 viper.GetBool("tls"),
+		SelfSigned:          viper.GetBool("self-signed"),
+		CredHub:             viper.GetString("credhub-url") != "",
+		ReplicatedSecrets:   replicatedSecrets,
+		MonitorCertificates: viper.GetBool("monitor-certificates"),
+		PropagateAddress:    viper.GetBool("propagate-address"),
+		ExternalDNS:         viper.GetString("external-dns"),
+		// The TLS listener is started only along with the proxy
+		ProxyTLS: viper.GetString("proxy-address") != "" && viper.GetString("proxy-tls-address") != "",
+	})
+}
+
+// requiredAPIResources returns the API resources needed by the features enabled with the root flags
+func requiredAPIResources() []ingress.APIResource {
+	resources := append([]ingress.APIResource{}, ingress.IngressAPIResources...)
+	if viper.GetString("external-dns") == ingress.ExternalDNSEndpoints {
+		resources = append(resources, ingress.APIResource{
+			GroupVersionResource: ingress.DNSEndpointResource,
+			Required:             true,
+			Hint:                 "install the DNSEndpoint CRD of ExternalDNS, or use --external-dns=annotations",
+		})
+	}
+	return resources
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	ingress "github.com/mudler/eirini-ingress/extensions/ingress"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	doctorCmd.Flags().StringP("output", "o", "text", "Output format, either 'text' or 'json'")
+	rootCmd.AddCommand(doctorCmd)
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the permissions and the APIs needed by the enabled features",
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		if output != "text" && output != "json" {
+			fmt.Printf("invalid output format %q\n", output)
+			os.Exit(1)
+		}
+
+		client, err := newClientSet()
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		results, err := ingress.CheckPermissions(client, requiredPermissions())
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		apis, err := ingress.CheckAPIResources(client.Discovery(), requiredAPIResources())
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		results = append(results, apis...)
+
+		failed := 0
+		for _, r := range results {
+			if !r.Passed {
+				failed++
+			}
+		}
+		if output == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(results)
+		} else {
+			for _, r := range results {
+				status := "PASS"
+				if !r.Passed {
+					status = "FAIL"
+				}
+				fmt.Printf("[%s] %s (%s)\n", status, r.Check, r.Message)
+				if r.Hint != "" {
+					fmt.Printf("       %s\n", r.Hint)
+				}
+			}
+			fmt.Printf("%d checks, %d failed\n", len(results), failed)
+		}
+		if failed != 0 {
+			os.Exit(1)
+		}
+	},
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	ingress "github.com/mudler/eirini-ingress/extensions/ingress"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func init() {
+	importGorouterCmd.Flags().StringP("filename", "f", "", "Gorouter /routes dump or routing API routes, '-' reads stdin")
+	importGorouterCmd.Flags().StringSlice("pods", nil, "Pod manifests to match the routes with, instead of the pods in the cluster")
+	importGorouterCmd.Flags().StringP("output", "o", "yaml", "Output format, either 'yaml' or 'json'")
+	importGorouterCmd.MarkFlagRequired("filename")
+	rootCmd.AddCommand(importGorouterCmd)
+}
+
+var importGorouterCmd = &cobra.Command{
+	Use:   "import-gorouter -f routes.json",
+	Short: "Print the Services and Ingresses of the Eirini apps for the routes of a gorouter routing table",
+	Run: func(cmd *cobra.Command, args []string) {
+		file, _ := cmd.Flags().GetString("filename")
+		podFiles, _ := cmd.Flags().GetStringSlice("pods")
+		output, _ := cmd.Flags().GetString("output")
+
+		var data []byte
+		var err error
+		if file == "-" {
+			data, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			data, err = ioutil.ReadFile(file)
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		routes, err := ingress.ParseGorouterRoutes(data)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+
+		ext, err := newPodWatcher()
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		var pods []corev1.Pod
+		if len(podFiles) != 0 {
+			pods, err = readPods(podFiles, viper.GetString("namespace"))
+		} else {
+			client, clientErr := newClientSet()
+			if clientErr != nil {
+				fmt.Println(clientErr.Error())
+				os.Exit(1)
+			}
+			var list *corev1.PodList
+			list, err = client.CoreV1().Pods(viper.GetString("namespace")).List(metav1.ListOptions{})
+			if err == nil {
+				pods = list.Items
+			}
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+
+		objects, unmatched := ext.ImportGorouterRoutes(pods, routes)
+		if err := printObjects(os.Stdout, output, objects); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		if len(unmatched) != 0 {
+			fmt.Fprintf(os.Stderr, "%d of %d routes couldn't be matched:\n", len(unmatched), len(routes))
+			for _, r := range unmatched {
+				fmt.Fprintf(os.Stderr, "  - %s (app %s): %s\n", r.URI, r.AppGUID, r.Reason)
+			}
+		}
+	},
+}
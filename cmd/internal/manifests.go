@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	ingress "github.com/mudler/eirini-ingress/extensions/ingress"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const manifestsName = "eirini-ingress"
+
+// envNames are the environment variables not named after their flag
+var envNames = map[string]string{"tls": "ENABLE_TLS"}
+
+// secretFlags are passed to the Deployment from a Secret
+var secretFlags = map[string]interface{}{"credhub-token": nil, "credhub-secret": nil, "route-services-secret": nil}
+
+// listenFlags are the addresses of the servers, exposed as container ports
+var listenFlags = []string{"metrics-address", "admin-address", "dns-address", "xds-address", "proxy-address", "proxy-tls-address"}
+
+func init() {
+	manifestsCmd.Flags().String("install-namespace", manifestsName, "Namespace to deploy the extension in")
+	manifestsCmd.Flags().String("image", "quay.io/mudler/eirinix-ingress", "Image of the extension")
+	manifestsCmd.Flags().StringP("output", "o", "yaml", "Output format, either 'yaml' or 'json'")
+	rootCmd.AddCommand(manifestsCmd)
+}
+
+func flagEnvName(name string) string {
+	if env, ok := envNames[name]; ok {
+		return env
+	}
+	return strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+// listenPort returns the port of a listen address, e.g. 9090 for ':9090'
+func listenPort(address string) (int32, bool) {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return 0, false
+	}
+	p, err := strconv.Atoi(port)
+	return int32(p), err == nil && p > 0
+}
+
+// deploymentManifests returns the resources deploying the extension with the root flags
+func deploymentManifests(installNamespace, image string) []runtime.Object {
+	labels := map[string]string{"name": manifestsName}
+	meta := func(namespace string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: manifestsName, Namespace: namespace, Labels: labels}
+	}
+	objects := []runtime.Object{
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: installNamespace}},
+		&corev1.ServiceAccount{ObjectMeta: meta(installNamespace)},
+	}
+
+	rules := ingress.PolicyRules(requiredPermissions())
+	namespaces := map[string]interface{}{}
+	for ns := range rules {
+		namespaces[ns] = nil
+	}
+	for _, ns := range sortedKeys(namespaces) {
+		objects = append(objects,
+			&rbacv1.Role{ObjectMeta: meta(ns), Rules: rules[ns]},
+			&rbacv1.RoleBinding{
+				ObjectMeta: meta(ns),
+				RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: manifestsName},
+				Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: manifestsName, Namespace: installNamespace}},
+			})
+	}
+
+	// Pass the flags differing from their default as environment variables
+	env := []corev1.EnvVar{}
+	secret := &corev1.Secret{ObjectMeta: meta(installNamespace), StringData: map[string]string{}}
+	rootCmd.PersistentFlags().VisitAll(func(f *pflag.Flag) {
+		value := viper.GetString(f.Name)
+		if f.Name == "kubeconfig" || (f.Name != "namespace" && value == f.DefValue) {
+			return
+		}
+		name := flagEnvName(f.Name)
+		if _, ok := secretFlags[f.Name]; ok {
+			secret.StringData[name] = value
+			env = append(env, corev1.EnvVar{Name: name, ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: manifestsName}, Key: name},
+			}})
+			return
+		}
+		env = append(env, corev1.EnvVar{Name: name, Value: value})
+	})
+	if len(secret.StringData) != 0 {
+		secret.Type = corev1.SecretTypeOpaque
+		objects = append(objects, secret)
+	}
+
+	ports := []corev1.ContainerPort{}
+	for _, f := range listenFlags {
+		if port, ok := listenPort(viper.GetString(f)); ok {
+			name := strings.TrimSuffix(f, "-address")
+			ports = append(ports, corev1.ContainerPort{Name: name, ContainerPort: port})
+			if f == "dns-address" {
+				ports = append(ports, corev1.ContainerPort{Name: "dns-udp", ContainerPort: port, Protocol: corev1.ProtocolUDP})
+			}
+		}
+	}
+
+	replicas := int32(1)
+	objects = append(objects, &appsv1.Deployment{
+		ObjectMeta: meta(installNamespace),
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: manifestsName,
+					Containers: []corev1.Container{{
+						Name:            manifestsName,
+						Image:           image,
+						ImagePullPolicy: corev1.PullAlways,
+						Env:             env,
+						Ports:           ports,
+					}},
+				},
+			},
+		},
+	})
+
+	if port, ok := listenPort(viper.GetString("metrics-address")); ok {
+		objects = append(objects, &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: manifestsName + "-metrics", Namespace: installNamespace, Labels: labels},
+			Spec: corev1.ServiceSpec{
+				Selector: labels,
+				Ports:    []corev1.ServicePort{{Name: "metrics", Port: port, TargetPort: intstr.FromString("metrics")}},
+			},
+		})
+	}
+	return objects
+}
+
+var manifestsCmd = &cobra.Command{
+	Use:   "manifests",
+	Short: "Print the manifests deploying the extension with the given flags",
+	Run: func(cmd *cobra.Command, args []string) {
+		installNamespace, _ := cmd.Flags().GetString("install-namespace")
+		image, _ := cmd.Flags().GetString("image")
+		output, _ := cmd.Flags().GetString("output")
+
+		// Fail early on invalid flags, rather than at the start of the Deployment
+		if _, err := newPodWatcher(); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		if err := printObjects(os.Stdout, output, deploymentManifests(installNamespace, image)); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	},
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	ingress "github.com/mudler/eirini-ingress/extensions/ingress"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	planCmd.Flags().StringP("output", "o", "text", "Output format, either 'text' or 'json'")
+	rootCmd.AddCommand(planCmd)
+}
+
+// printChanges prints the changes in a human readable diff
+func printChanges(w io.Writer, changes []ingress.Change) {
+	symbols := map[string]string{ingress.ActionCreate: "+", ingress.ActionUpdate: "~", ingress.ActionDelete: "-"}
+	count := map[string]int{}
+	for _, c := range changes {
+		count[c.Action]++
+		fmt.Fprintf(w, "%s %s %s/%s\n", symbols[c.Action], c.Kind, c.Namespace, c.Name)
+		for _, f := range c.Fields {
+			current, _ := json.Marshal(f.Current)
+			desired, _ := json.Marshal(f.Desired)
+			fmt.Fprintf(w, "    %s: %s -> %s\n", f.Path, current, desired)
+		}
+	}
+	fmt.Fprintf(w, "%d to create, %d to update, %d to delete\n",
+		count[ingress.ActionCreate], count[ingress.ActionUpdate], count[ingress.ActionDelete])
+}
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Show the changes needed to bring the Services and Ingresses of the namespace to the desired state, without applying them",
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+
+		ext, err := newPodWatcher()
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		client, err := newClientSet()
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		changes, err := ext.Plan(client, viper.GetString("namespace"))
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+
+		switch output {
+		case "json":
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(changes)
+		case "text":
+			printChanges(os.Stdout, changes)
+		default:
+			fmt.Printf("invalid output format %q\n", output)
+			os.Exit(1)
+		}
+		// Changes are pending, as in `diff`
+		if len(changes) != 0 {
+			os.Exit(2)
+		}
+	},
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	ingress "github.com/mudler/eirini-ingress/extensions/ingress"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+func init() {
+	purgeCmd.Flags().BoolP("yes", "y", false, "Delete without asking for confirmation")
+	purgeCmd.Flags().Bool("dry-run", false, "Only show the resources which would be deleted")
+	rootCmd.AddCommand(purgeCmd)
+}
+
+var purgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Delete all the resources created by the extension in the namespace, e.g. after uninstalling it",
+	Run: func(cmd *cobra.Command, args []string) {
+		yes, _ := cmd.Flags().GetBool("yes")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		config, err := kubeConfig()
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		client, err := kubernetes.NewForConfig(config)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		dyn, err := dynamic.NewForConfig(config)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+
+		resources, err := ingress.ManagedResources(client, dyn, viper.GetString("namespace"))
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		if len(resources) == 0 {
+			fmt.Println("No resources to delete")
+			return
+		}
+		for _, r := range resources {
+			fmt.Println("-", r.String())
+		}
+		if dryRun {
+			fmt.Printf("%d resources would be deleted\n", len(resources))
+			return
+		}
+		if !yes {
+			fmt.Printf("Delete %d resources? [y/N] ", len(resources))
+			answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+				fmt.Println("Aborted")
+				os.Exit(1)
+			}
+		}
+
+		failed := ingress.DeleteManagedResources(client, dyn, resources)
+		failures := []string{}
+		for r, err := range failed {
+			failures = append(failures, fmt.Sprintf("%s: %s", r, err.Error()))
+		}
+		sort.Strings(failures)
+		for _, f := range failures {
+			fmt.Fprintln(os.Stderr, "Failed to delete", f)
+		}
+		fmt.Printf("%d resources deleted, %d failed\n", len(resources)-len(failed), len(failed))
+		if len(failed) != 0 {
+			os.Exit(1)
+		}
+	},
+}
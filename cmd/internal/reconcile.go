@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	ingress "github.com/mudler/eirini-ingress/extensions/ingress"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+)
+
+func init() {
+	reconcileCmd.Flags().Bool("once", false, "Run a single reconciliation and exit")
+	rootCmd.AddCommand(reconcileCmd)
+}
+
+var reconcileCmd = &cobra.Command{
+	Use:   "reconcile --once",
+	Short: "Reconcile the resources of the namespace with its pods as the watcher does, in a single pass, e.g. from a Job",
+	Run: func(cmd *cobra.Command, args []string) {
+		if once, _ := cmd.Flags().GetBool("once"); !once {
+			fmt.Println("reconcile supports only --once, run eirini-ingress without subcommands to watch the pods")
+			os.Exit(1)
+		}
+
+		ext, err := newPodWatcher()
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		manager := newManager()
+		config, err := manager.GetKubeConnection()
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		client, err := kubernetes.NewForConfig(config)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		dyn, err := dynamic.NewForConfig(config)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		var recorder record.EventRecorder
+		if ext.TLS && viper.GetBool("monitor-certificates") {
+			recorder, err = ingress.NewEventRecorder(manager)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+		}
+		setupAppComponents(ext, recorder)
+
+		changes, failed, err := ext.Reconcile(client, dyn, viper.GetString("namespace"))
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+
+		printChanges(os.Stdout, changes)
+		failures := []string{}
+		for change, err := range failed {
+			failures = append(failures, fmt.Sprintf("%s: %s", change, err.Error()))
+		}
+		sort.Strings(failures)
+		for _, f := range failures {
+			fmt.Fprintln(os.Stderr, "Failed to", f)
+		}
+		fmt.Printf("%d changes planned, %d steps failed\n", len(changes), len(failed))
+		if len(failed) != 0 {
+			os.Exit(1)
+		}
+	},
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	ingress "github.com/mudler/eirini-ingress/extensions/ingress"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func init() {
+	renderCmd.Flags().StringSliceP("filename", "f", nil, "Pod manifests to render, '-' reads stdin")
+	renderCmd.Flags().StringP("output", "o", "yaml", "Output format, either 'yaml' or 'json'")
+	renderCmd.MarkFlagRequired("filename")
+	rootCmd.AddCommand(renderCmd)
+}
+
+var renderCmd = &cobra.Command{
+	Use:   "render -f pod.yaml",
+	Short: "Print the Services and Ingresses generated for pod manifests, without connecting to the cluster",
+	Run: func(cmd *cobra.Command, args []string) {
+		files, _ := cmd.Flags().GetStringSlice("filename")
+		output, _ := cmd.Flags().GetString("output")
+
+		ext, err := newPodWatcher()
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		pods, err := readPods(files, viper.GetString("namespace"))
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+
+		invalid := false
+		objects := []runtime.Object{}
+		rendered := map[string]interface{}{}
+		add := func(obj runtime.Object) {
+			accessor, _ := meta.Accessor(obj)
+			key := fmt.Sprintf("%T/%s/%s", obj, accessor.GetNamespace(), accessor.GetName())
+			if _, ok := rendered[key]; !ok {
+				rendered[key] = nil
+				objects = append(objects, obj)
+			}
+		}
+		for i := range pods {
+			pod := &pods[i]
+			app := ext.GetRouteHandler(pod)
+			if !app.Validate() {
+				invalid = true
+				fmt.Fprintf(os.Stderr, "Pod %s/%s is not a valid Eirini app:\n", pod.GetNamespace(), pod.GetName())
+				if eiriniApp, ok := app.(ingress.EiriniApp); ok {
+					for _, e := range eiriniApp.ValidationErrors() {
+						fmt.Fprintf(os.Stderr, "  - %s\n", e)
+					}
+				}
+				continue
+			}
+			// Routes left out of the generated resources are reported without failing
+			if eiriniApp, ok := app.(ingress.EiriniApp); ok {
+				for _, e := range eiriniApp.ValidationErrors() {
+					fmt.Fprintf(os.Stderr, "Pod %s/%s: %s\n", pod.GetNamespace(), pod.GetName(), e)
+				}
+			}
+			// Instances of the same app share the Service and Ingress
+			add(ext.DesiredService(app))
+			// Apps whose routes are all bound to route services have no ingress
+			if in := ext.DesiredIngress(app); len(in.Spec.Rules) != 0 {
+				add(in)
+			}
+			if ext.InstanceServices {
+				add(ext.DesiredInstanceService(pod))
+			}
+		}
+
+		if err := printObjects(os.Stdout, output, objects); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		if invalid {
+			os.Exit(1)
+		}
+	},
+}
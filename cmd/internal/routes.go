@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	ingress "github.com/mudler/eirini-ingress/extensions/ingress"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+func init() {
+	routesCmd.PersistentFlags().StringP("output", "o", "table", "Output format, either 'table', 'json' or 'yaml'")
+	routesCmd.AddCommand(routesListCmd)
+	routesCmd.AddCommand(routesGetCmd)
+	rootCmd.AddCommand(routesCmd)
+}
+
+// resourceState returns the name of a generated resource, marking the missing ones
+func resourceState(name string, exists bool) string {
+	if !exists {
+		return name + " (missing)"
+	}
+	return name
+}
+
+// printRoutes prints the route statuses in the format
+func printRoutes(w io.Writer, format string, statuses []ingress.RouteStatus) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(statuses)
+	case "yaml":
+		data, err := sigsyaml.Marshal(statuses)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "HOSTNAME\tPORT\tAPP\tGUID\tNAMESPACE\tREADY\tSERVICE\tINGRESS\tTLS SECRET\tADDRESS")
+		for _, s := range statuses {
+			tlsSecret := s.TLSSecret
+			if tlsSecret == "" {
+				tlsSecret = "-"
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%d/%d\t%s\t%s\t%s\t%s\n",
+				s.Hostname, s.Port, s.App, s.GUID, s.Namespace, s.Ready, s.Instances,
+				resourceState(s.Service, s.ServiceExists), resourceState(s.Ingress, s.IngressExists),
+				tlsSecret, strconv.FormatBool(s.HasAddress))
+		}
+		return tw.Flush()
+	}
+	return fmt.Errorf("invalid output format %q", format)
+}
+
+var routesCmd = &cobra.Command{
+	Use:   "routes",
+	Short: "Inspect the hostnames of the Eirini apps and the resources generated for them",
+}
+
+var routesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the hostnames of all the Eirini apps",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+
+		ext, err := newPodWatcher()
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		client, err := newClientSet()
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		statuses, err := ext.RouteStatuses(client, viper.GetString("namespace"))
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		if err := printRoutes(os.Stdout, output, statuses); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+var routesGetCmd = &cobra.Command{
+	Use:   "get <hostname>",
+	Short: "Show the Eirini app serving a hostname",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+
+		ext, err := newPodWatcher()
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		client, err := newClientSet()
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		statuses, ok, err := ext.RouteStatus(client, viper.GetString("namespace"), args[0])
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		if !ok {
+			fmt.Printf("no app serves %s\n", args[0])
+			os.Exit(1)
+		}
+		if err := printRoutes(os.Stdout, output, statuses); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	},
+}
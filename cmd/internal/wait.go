@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	ingress "github.com/mudler/eirini-ingress/extensions/ingress"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	waitCmd.Flags().String("app", "", "Name of the app to wait for")
+	waitCmd.Flags().Duration("timeout", 5*time.Minute, "Time to wait before failing")
+	waitCmd.Flags().Duration("interval", 2*time.Second, "Interval between checks")
+	waitCmd.Flags().Bool("http", false, "Wait until a GET on each hostname of the app succeeds too")
+	waitCmd.Flags().Bool("insecure", false, "Skip the verification of the certificates for the HTTP checks")
+	waitCmd.MarkFlagRequired("app")
+	rootCmd.AddCommand(waitCmd)
+}
+
+var waitCmd = &cobra.Command{
+	Use:   "wait --app <name>",
+	Short: "Wait until an app is reachable through its ingress",
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("app")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		interval, _ := cmd.Flags().GetDuration("interval")
+		checkHTTP, _ := cmd.Flags().GetBool("http")
+		insecure, _ := cmd.Flags().GetBool("insecure")
+
+		ext, err := newPodWatcher()
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		client, err := newClientSet()
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+
+		scheme := "http"
+		if ext.TLS {
+			scheme = "https"
+		}
+		httpClient := &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure}},
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+
+		// check returns the reason the app is not reachable yet, or an empty string, and whether
+		// the app can't become reachable by waiting
+		check := func() (string, bool, error) {
+			readiness, err := ext.AppReadiness(client, viper.GetString("namespace"), name)
+			if err != nil || !readiness.Ready {
+				return readiness.Reason, readiness.Terminal, err
+			}
+			if checkHTTP {
+				for _, h := range readiness.Hostnames {
+					if err := ingress.CheckHTTP(httpClient, scheme, h); err != nil {
+						return err.Error(), false, nil
+					}
+				}
+			}
+			return "", false, nil
+		}
+
+		deadline := time.Now().Add(timeout)
+		reason := ""
+		for {
+			var terminal bool
+			reason, terminal, err = check()
+			if err != nil {
+				reason = err.Error()
+			} else if reason == "" {
+				fmt.Printf("App %s is reachable\n", name)
+				return
+			} else if terminal {
+				fmt.Printf("App %s can't become reachable: %s\n", name, reason)
+				os.Exit(1)
+			}
+			if time.Now().Add(interval).After(deadline) {
+				break
+			}
+			time.Sleep(interval)
+		}
+		fmt.Printf("Timed out waiting for the app %s: %s\n", name, reason)
+		os.Exit(1)
+	},
+}
@@ -0,0 +1,198 @@
+package ingress
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	eirinix "github.com/SUSE/eirinix"
+	corev1 "k8s.io/api/core/v1"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	watchtools "k8s.io/client-go/tools/watch"
+)
+
+const (
+	// IngressAddressAnnotation is the annotation containing the load balancer addresses of the app ingress
+	IngressAddressAnnotation = "eirinix.suse.org/ingress-address"
+	// RouteProgrammedAnnotation is the annotation containing the time the ingress got its current address
+	RouteProgrammedAnnotation = "eirinix.suse.org/route-programmed"
+	// ReasonIngressAddressChanged is the event reason for ingress address changes
+	ReasonIngressAddressChanged = "IngressAddressChanged"
+)
+
+// AddressPropagator records the load balancer address of the generated ingresses on the apps
+// they route to, as annotations on their StatefulSet (or pods, if they don't have one).
+type AddressPropagator struct {
+	// Recorder emits an event on the app when the address changes, if set
+	Recorder record.EventRecorder
+}
+
+// NewAddressPropagator returns an AddressPropagator emitting events with the given recorder
+func NewAddressPropagator(recorder record.EventRecorder) *AddressPropagator {
+	return &AddressPropagator{Recorder: recorder}
+}
+
+// Propagate records the current address of the ingress on the app it routes to.
+// Ingresses which don't route to an Eirini app are ignored.
+func (a *AddressPropagator) Propagate(client kubernetes.Interface, in *v1beta1.Ingress) error {
+	pods, err := ingressPods(client, in)
+	if err != nil || len(pods) == 0 {
+		return err
+	}
+	address := strings.Join(loadBalancerAddresses(in), ",")
+
+	var patch []byte
+	if address == "" {
+		patch, err = json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{IngressAddressAnnotation: nil, RouteProgrammedAnnotation: nil},
+		}})
+	} else {
+		patch, err = json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{
+			"annotations": map[string]string{IngressAddressAnnotation: address, RouteProgrammedAnnotation: time.Now().UTC().Format(time.RFC3339)},
+		}})
+	}
+	if err != nil {
+		return err
+	}
+
+	patched := map[string]interface{}{}
+	for i := range pods {
+		pod := &pods[i]
+		ref := appReference(pod)
+		if _, ok := patched[ref.Name]; ok {
+			continue
+		}
+		patched[ref.Name] = nil
+
+		var obj runtime.Object
+		if ref.Kind == "StatefulSet" {
+			obj, err = client.AppsV1().StatefulSets(pod.GetNamespace()).Get(ref.Name, metav1.GetOptions{})
+		} else {
+			obj = pod
+		}
+		if err != nil {
+			return err
+		}
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return err
+		}
+		previous := accessor.GetAnnotations()[IngressAddressAnnotation]
+		if previous == address {
+			continue
+		}
+
+		if ref.Kind == "StatefulSet" {
+			_, err = client.AppsV1().StatefulSets(pod.GetNamespace()).Patch(ref.Name, types.MergePatchType, patch)
+		} else {
+			_, err = client.CoreV1().Pods(pod.GetNamespace()).Patch(ref.Name, types.MergePatchType, patch)
+		}
+		if err != nil {
+			return err
+		}
+
+		if a.Recorder != nil {
+			switch {
+			case address == "":
+				a.Recorder.Eventf(ref, corev1.EventTypeWarning, ReasonIngressAddressChanged, "Ingress %s lost its address %s", in.GetName(), previous)
+			case previous == "":
+				a.Recorder.Eventf(ref, corev1.EventTypeNormal, ReasonIngressAddressChanged, "Ingress %s is served at %s", in.GetName(), address)
+			default:
+				a.Recorder.Eventf(ref, corev1.EventTypeNormal, ReasonIngressAddressChanged, "Ingress %s address changed from %s to %s", in.GetName(), previous, address)
+			}
+		}
+	}
+	return nil
+}
+
+// ingressPods returns the pods of the Eirini app the ingress routes to
+func ingressPods(client kubernetes.Interface, in *v1beta1.Ingress) ([]corev1.Pod, error) {
+	service := ""
+	for _, r := range in.Spec.Rules {
+		if r.HTTP != nil && len(r.HTTP.Paths) != 0 {
+			service = r.HTTP.Paths[0].Backend.ServiceName
+			break
+		}
+	}
+	if service == "" {
+		return nil, nil
+	}
+
+	svc, err := client.CoreV1().Services(in.GetNamespace()).Get(service, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := svc.Spec.Selector[eirinix.LabelGUID]; !ok {
+		return nil, nil
+	}
+
+	set := labels.Set(svc.Spec.Selector)
+	pods, err := client.CoreV1().Pods(in.GetNamespace()).List(metav1.ListOptions{LabelSelector: set.AsSelector().String()})
+	if err != nil {
+		return nil, err
+	}
+	return pods.Items, nil
+}
+
+// Run watches the ingresses of the namespace and propagates their address until stop is closed
+func (a *AddressPropagator) Run(manager eirinix.Manager, namespace string, stop <-chan struct{}) error {
+	clientset, err := getClientSet(manager)
+	if err != nil {
+		return err
+	}
+
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return clientset.ExtensionsV1beta1().Ingresses(namespace).List(options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return clientset.ExtensionsV1beta1().Ingresses(namespace).Watch(options)
+		},
+	}
+	list, err := clientset.ExtensionsV1beta1().Ingresses(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for i := range list.Items {
+		if err := a.Propagate(clientset, &list.Items[i]); err != nil {
+			manager.GetLogger().Error(err.Error())
+		}
+	}
+
+	w, err := watchtools.NewRetryWatcher(list.GetResourceVersion(), lw)
+	if err != nil {
+		return err
+	}
+	defer w.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case e, ok := <-w.ResultChan():
+			if !ok {
+				return nil
+			}
+			in, ok := e.Object.(*v1beta1.Ingress)
+			if !ok || e.Type == watch.Deleted {
+				continue
+			}
+			if err := a.Propagate(clientset, in); err != nil {
+				manager.GetLogger().Error(err.Error())
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package ingress_test
+
+import (
+	eirinix "github.com/SUSE/eirinix"
+	. "github.com/mudler/eirini-ingress/extensions/ingress"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+var _ = Describe("Address propagator", func() {
+	var (
+		recorder   *record.FakeRecorder
+		propagator *AddressPropagator
+		in         *v1beta1.Ingress
+		service    *corev1.Service
+	)
+
+	BeforeEach(func() {
+		recorder = record.NewFakeRecorder(10)
+		propagator = NewAddressPropagator(recorder)
+		service = &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "eirini", Name: "foo"},
+			Spec:       corev1.ServiceSpec{Selector: map[string]string{eirinix.LabelGUID: "foo-guid"}},
+		}
+		in = &v1beta1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "eirini", Name: "foo"},
+			Spec: v1beta1.IngressSpec{
+				Rules: []v1beta1.IngressRule{{
+					Host: "foo.example.com",
+					IngressRuleValue: v1beta1.IngressRuleValue{HTTP: &v1beta1.HTTPIngressRuleValue{
+						Paths: []v1beta1.HTTPIngressPath{{Backend: v1beta1.IngressBackend{ServiceName: "foo"}}},
+					}},
+				}},
+			},
+			Status: v1beta1.IngressStatus{LoadBalancer: corev1.LoadBalancerStatus{
+				Ingress: []corev1.LoadBalancerIngress{{IP: "10.0.0.1"}, {Hostname: "lb.example.com"}},
+			}},
+		}
+	})
+
+	Context("with apps running as StatefulSets", func() {
+		var client *fake.Clientset
+
+		BeforeEach(func() {
+			objects := []runtime.Object{
+				service,
+				&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Namespace: "eirini", Name: "foo-sts"}},
+			}
+			for _, instance := range []string{"0", "1"} {
+				pod := appPod("foo", "foo-guid", instance, `[{"hostname":"foo.example.com","port":8080}]`)
+				pod.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "foo-sts"}}
+				objects = append(objects, pod)
+			}
+			client = fake.NewSimpleClientset(objects...)
+		})
+
+		It("annotates the StatefulSet once and emits an event", func() {
+			Expect(propagator.Propagate(client, in)).To(Succeed())
+
+			sts, err := client.AppsV1().StatefulSets("eirini").Get("foo-sts", metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sts.Annotations[IngressAddressAnnotation]).To(Equal("10.0.0.1,lb.example.com"))
+			Expect(sts.Annotations).To(HaveKey(RouteProgrammedAnnotation))
+
+			pod, err := client.CoreV1().Pods("eirini").Get("foo-0", metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pod.Annotations).ToNot(HaveKey(IngressAddressAnnotation))
+
+			Expect(recorder.Events).To(HaveLen(1))
+			Expect(<-recorder.Events).To(Equal("Normal IngressAddressChanged Ingress foo is served at 10.0.0.1,lb.example.com"))
+
+			// Nothing changes without a new address
+			Expect(propagator.Propagate(client, in)).To(Succeed())
+			Expect(recorder.Events).To(BeEmpty())
+		})
+
+		It("removes the annotations when the ingress loses its address", func() {
+			Expect(propagator.Propagate(client, in)).To(Succeed())
+			<-recorder.Events
+
+			in.Status.LoadBalancer.Ingress = nil
+			Expect(propagator.Propagate(client, in)).To(Succeed())
+
+			sts, err := client.AppsV1().StatefulSets("eirini").Get("foo-sts", metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sts.Annotations).ToNot(HaveKey(IngressAddressAnnotation))
+			Expect(sts.Annotations).ToNot(HaveKey(RouteProgrammedAnnotation))
+			Expect(<-recorder.Events).To(Equal("Warning IngressAddressChanged Ingress foo lost its address 10.0.0.1,lb.example.com"))
+		})
+	})
+
+	It("annotates the pods without a StatefulSet", func() {
+		client := fake.NewSimpleClientset(service, appPod("foo", "foo-guid", "0", `[{"hostname":"foo.example.com","port":8080}]`))
+		Expect(propagator.Propagate(client, in)).To(Succeed())
+
+		pod, err := client.CoreV1().Pods("eirini").Get("foo-0", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pod.Annotations[IngressAddressAnnotation]).To(Equal("10.0.0.1,lb.example.com"))
+		Expect(pod.Annotations[AppNameAnnotation]).To(Equal("foo"))
+		Expect(<-recorder.Events).To(Equal("Normal IngressAddressChanged Ingress foo is served at 10.0.0.1,lb.example.com"))
+	})
+
+	It("does nothing until the ingress has an address", func() {
+		client := fake.NewSimpleClientset(service, appPod("foo", "foo-guid", "0", `[{"hostname":"foo.example.com","port":8080}]`))
+		in.Status.LoadBalancer.Ingress = nil
+		Expect(propagator.Propagate(client, in)).To(Succeed())
+
+		pod, err := client.CoreV1().Pods("eirini").Get("foo-0", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pod.Annotations).ToNot(HaveKey(IngressAddressAnnotation))
+		Expect(recorder.Events).To(BeEmpty())
+	})
+
+	It("ignores the ingresses not routing to an Eirini app", func() {
+		service.Spec.Selector = map[string]string{"app": "other"}
+		client := fake.NewSimpleClientset(service, appPod("foo", "foo-guid", "0", `[{"hostname":"foo.example.com","port":8080}]`))
+		Expect(propagator.Propagate(client, in)).To(Succeed())
+		Expect(recorder.Events).To(BeEmpty())
+	})
+})
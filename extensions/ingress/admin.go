@@ -0,0 +1,131 @@
+package ingress
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// AdminAPI serves the RouteTable over HTTP.
+//
+// GET /routes lists the routes, optionally filtered by the hostname, app, guid and namespace
+// query parameters. GET /routes/events streams the route changes as server-sent events.
+// GET /routes/conflicts lists the hostnames claimed by more than one app.
+type AdminAPI struct {
+	Routes *RouteTable
+}
+
+// NewAdminAPI returns an AdminAPI for the route table
+func NewAdminAPI(routes *RouteTable) *AdminAPI {
+	return &AdminAPI{Routes: routes}
+}
+
+// Handler returns the http.Handler of the API
+func (a *AdminAPI) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/routes", a.listRoutes)
+	mux.HandleFunc("/routes/events", a.streamEvents)
+	mux.HandleFunc("/routes/conflicts", a.listConflicts)
+	return mux
+}
+
+// RouteFilter selects routes by their fields, empty fields match everything
+type RouteFilter struct {
+	Hostname, App, GUID, Namespace string
+}
+
+func newRouteFilter(r *http.Request) RouteFilter {
+	q := r.URL.Query()
+	return RouteFilter{
+		Hostname:  q.Get("hostname"),
+		App:       q.Get("app"),
+		GUID:      q.Get("guid"),
+		Namespace: q.Get("namespace"),
+	}
+}
+
+// Match returns true if the route matches the filter
+func (f RouteFilter) Match(r RouteEntry) bool {
+	return (f.Hostname == "" || strings.EqualFold(f.Hostname, r.Hostname)) &&
+		(f.App == "" || f.App == r.App) &&
+		(f.GUID == "" || f.GUID == r.GUID) &&
+		(f.Namespace == "" || f.Namespace == r.Namespace)
+}
+
+func (a *AdminAPI) listRoutes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filter := newRouteFilter(r)
+	routes := []RouteEntry{}
+	for _, route := range a.Routes.Routes() {
+		if filter.Match(route) {
+			routes = append(routes, route)
+		}
+	}
+	// Wildcard routes serve hostnames which are not listed explicitly
+	if len(routes) == 0 && filter.Hostname != "" {
+		if app, ok := a.Routes.Lookup(filter.Hostname); ok {
+			wildcard := filter
+			wildcard.Hostname = ""
+			for _, route := range app.Entries() {
+				if strings.HasPrefix(route.Hostname, "*.") && wildcard.Match(route) {
+					routes = append(routes, route)
+				}
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(routes)
+}
+
+func (a *AdminAPI) listConflicts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.Routes.Conflicts())
+}
+
+func (a *AdminAPI) streamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	filter := newRouteFilter(r)
+	events, cancel := a.Routes.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			if !filter.Match(e.Route) {
+				continue
+			}
+			data, err := json.Marshal(e.Route)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package ingress_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	eirinix "github.com/SUSE/eirinix"
+	. "github.com/mudler/eirini-ingress/extensions/ingress"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func appPod(name, guid, instance, routes string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "eirini",
+			Name:      name + "-" + instance,
+			Labels:    map[string]string{eirinix.LabelGUID: guid},
+			Annotations: map[string]string{
+				AppNameAnnotation: name,
+				RoutesAnnotation:  routes,
+			},
+		},
+		Status: corev1.PodStatus{
+			PodIP:      "10.1.0." + instance,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+		},
+	}
+}
+
+var _ = Describe("Admin API", func() {
+	var (
+		routes *RouteTable
+		server *httptest.Server
+	)
+
+	BeforeEach(func() {
+		routes = NewRouteTable()
+		for _, pod := range []*corev1.Pod{
+			appPod("foo", "foo-guid", "0", `[{"hostname":"foo.example.com","port":8080}]`),
+			appPod("foo", "foo-guid", "1", `[{"hostname":"foo.example.com","port":8080}]`),
+			appPod("bar", "bar-guid", "0", `[{"hostname":"bar.example.com","port":8080},{"hostname":"*.wild.example.com","port":8080}]`),
+		} {
+			routes.Update(NewEiriniApp(pod), pod, pod.Annotations[AppNameAnnotation], pod.Annotations[AppNameAnnotation])
+		}
+		server = httptest.NewServer(NewAdminAPI(routes).Handler())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	get := func(path string) []RouteEntry {
+		resp, err := http.Get(server.URL + path)
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close()
+		res := []RouteEntry{}
+		Expect(json.NewDecoder(resp.Body).Decode(&res)).To(Succeed())
+		return res
+	}
+
+	It("lists and filters the routes", func() {
+		Expect(get("/routes")).To(HaveLen(3))
+
+		res := get("/routes?hostname=foo.example.com")
+		Expect(res).To(HaveLen(1))
+		Expect(res[0]).To(Equal(RouteEntry{
+			Hostname: "foo.example.com", Port: 8080, App: "foo", GUID: "foo-guid", Namespace: "eirini",
+			Instances: 2, Ready: 2, Service: "foo", Ingress: "foo",
+		}))
+
+		Expect(get("/routes?app=bar")).To(HaveLen(2))
+		Expect(get("/routes?guid=none")).To(BeEmpty())
+
+		res = get("/routes?hostname=x.wild.example.com")
+		Expect(res).To(HaveLen(1))
+		Expect(res[0].App).To(Equal("bar"))
+	})
+
+	It("serves conflicting hostnames from the app with the lowest GUID", func() {
+		pod := appPod("another", "another-guid", "0", `[{"hostname":"FOO.example.com","port":9090}]`)
+		routes.Update(NewEiriniApp(pod), pod, "another", "another")
+
+		for i := 0; i < 10; i++ {
+			app, ok := routes.Lookup("foo.example.com")
+			Expect(ok).To(BeTrue())
+			Expect(app.Name).To(Equal("another"))
+		}
+
+		resp, err := http.Get(server.URL + "/routes/conflicts")
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close()
+		conflicts := []RouteConflict{}
+		Expect(json.NewDecoder(resp.Body).Decode(&conflicts)).To(Succeed())
+		Expect(conflicts).To(Equal([]RouteConflict{
+			{Hostname: "foo.example.com", Apps: []string{"eirini/another", "eirini/foo"}},
+		}))
+	})
+
+	It("reports each conflict once, until its apps change", func() {
+		Expect(routes.ChangedConflicts()).To(BeEmpty())
+		pod := appPod("another", "another-guid", "0", `[{"hostname":"foo.example.com","port":9090}]`)
+		routes.Update(NewEiriniApp(pod), pod, "another", "another")
+		Expect(routes.ChangedConflicts()).To(Equal([]RouteConflict{
+			{Hostname: "foo.example.com", Apps: []string{"eirini/another", "eirini/foo"}},
+		}))
+
+		// e.g. the readiness of an instance flapping
+		routes.Update(NewEiriniApp(pod), pod, "another", "another")
+		Expect(routes.ChangedConflicts()).To(BeEmpty())
+
+		third := appPod("third", "a-guid", "0", `[{"hostname":"foo.example.com","port":9090}]`)
+		routes.Update(NewEiriniApp(third), third, "third", "third")
+		Expect(routes.ChangedConflicts()).To(Equal([]RouteConflict{
+			{Hostname: "foo.example.com", Apps: []string{"eirini/third", "eirini/another", "eirini/foo"}},
+		}))
+	})
+
+	It("removes the pods which are no longer valid apps", func() {
+		// The annotations of the app were removed from the pod
+		pod := appPod("bar", "bar-guid", "0", "")
+		pod.Annotations = nil
+		routes.DeletePod(pod)
+		Expect(get("/routes?app=bar")).To(BeEmpty())
+
+		pod = appPod("foo", "foo-guid", "1", "")
+		pod.Annotations = nil
+		routes.DeletePod(pod)
+		res := get("/routes?app=foo")
+		Expect(res).To(HaveLen(1))
+		Expect(res[0].Instances).To(Equal(1))
+	})
+
+	It("streams the route changes", func() {
+		resp, err := http.Get(server.URL + "/routes/events?app=baz")
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.Header.Get("Content-Type")).To(Equal("text/event-stream"))
+
+		pod := appPod("baz", "baz-guid", "0", `[{"hostname":"baz.example.com","port":8080}]`)
+		routes.Update(NewEiriniApp(pod), pod, "baz", "baz")
+		routes.Delete(NewEiriniApp(pod), pod)
+
+		reader := bufio.NewReader(resp.Body)
+		lines := []string{}
+		for len(lines) < 4 {
+			line, err := reader.ReadString('\n')
+			Expect(err).ToNot(HaveOccurred())
+			if line = strings.TrimSpace(line); line != "" {
+				lines = append(lines, line)
+			}
+		}
+		Expect(lines[0]).To(Equal("event: added"))
+		Expect(lines[1]).To(ContainSubstring(`"hostname":"baz.example.com"`))
+		Expect(lines[2]).To(Equal("event: removed"))
+	})
+})
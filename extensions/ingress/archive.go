@@ -0,0 +1,224 @@
+package ingress
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// RouteArchiveVersion is the version of the archive format
+	RouteArchiveVersion = 1
+
+	// ConflictSkip leaves the existing resources untouched on import
+	ConflictSkip = "skip"
+	// ConflictOverwrite updates the existing resources to the archived ones on import
+	ConflictOverwrite = "overwrite"
+	// ConflictFail aborts the import, before any change, if a resource exists already
+	ConflictFail = "fail"
+)
+
+// RouteArchive is the exported state of the resources generated for the apps of a namespace.
+// Routes are informative, as the route table is rebuilt from the pods.
+type RouteArchive struct {
+	Version    int               `json:"version"`
+	Namespace  string            `json:"namespace"`
+	ExportedAt time.Time         `json:"exported_at"`
+	Services   []corev1.Service  `json:"services"`
+	Ingresses  []v1beta1.Ingress `json:"ingresses"`
+	Routes     []RouteEntry      `json:"routes"`
+}
+
+// ImportResult lists the resources handled by an import, as "<kind> <namespace>/<name>"
+type ImportResult struct {
+	Created []string `json:"created"`
+	Updated []string `json:"updated"`
+	Skipped []string `json:"skipped"`
+}
+
+// exportMeta keeps only the metadata which can be applied to another cluster
+func exportMeta(meta metav1.ObjectMeta) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:        meta.Name,
+		Namespace:   meta.Namespace,
+		Labels:      meta.Labels,
+		Annotations: meta.Annotations,
+	}
+}
+
+// mergeMaps returns the entries of current updated with the archived ones
+func mergeMaps(current, archived map[string]string) map[string]string {
+	if len(current) == 0 && len(archived) == 0 {
+		return current
+	}
+	merged := map[string]string{}
+	for k, v := range current {
+		merged[k] = v
+	}
+	for k, v := range archived {
+		merged[k] = v
+	}
+	return merged
+}
+
+// Export returns the archive of the Services and Ingresses generated in the namespace, those
+// with the ownership label, and of its route table
+func (pw *PodWatcher) Export(client kubernetes.Interface, namespace string) (*RouteArchive, error) {
+	archive := &RouteArchive{
+		Version:    RouteArchiveVersion,
+		Namespace:  namespace,
+		ExportedAt: time.Now().UTC(),
+		Services:   []corev1.Service{},
+		Ingresses:  []v1beta1.Ingress{},
+	}
+
+	selector := labels.Set{ManagedByLabel: ManagedBy}.AsSelector().String()
+	services, err := client.CoreV1().Services(namespace).List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	for _, svc := range services.Items {
+		spec := svc.Spec.DeepCopy()
+		// The cluster IP is allocated by the target cluster
+		spec.ClusterIP = ""
+		archive.Services = append(archive.Services, corev1.Service{ObjectMeta: exportMeta(svc.ObjectMeta), Spec: *spec})
+	}
+
+	ingresses, err := client.ExtensionsV1beta1().Ingresses(namespace).List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	for _, in := range ingresses.Items {
+		archive.Ingresses = append(archive.Ingresses, v1beta1.Ingress{ObjectMeta: exportMeta(in.ObjectMeta), Spec: *in.Spec.DeepCopy()})
+	}
+	sort.Slice(archive.Services, func(i, j int) bool { return archive.Services[i].Name < archive.Services[j].Name })
+	sort.Slice(archive.Ingresses, func(i, j int) bool { return archive.Ingresses[i].Name < archive.Ingresses[j].Name })
+
+	routes, err := pw.routeTable(client, namespace)
+	if err != nil {
+		return nil, err
+	}
+	archive.Routes = routes.Routes()
+	return archive, nil
+}
+
+// Import recreates the archived Services and Ingresses. Namespaces are remapped with the
+// namespaces map, those not in the map are kept. Existing resources are handled with the
+// conflict policy: when overwritten, their spec is replaced and the archived labels and
+// annotations are merged into theirs.
+func Import(client kubernetes.Interface, archive *RouteArchive, namespaces map[string]string, policy string) (ImportResult, error) {
+	result := ImportResult{Created: []string{}, Updated: []string{}, Skipped: []string{}}
+	if archive.Version != RouteArchiveVersion {
+		return result, fmt.Errorf("unsupported archive version %d", archive.Version)
+	}
+	switch policy {
+	case ConflictSkip, ConflictOverwrite, ConflictFail:
+	default:
+		return result, fmt.Errorf("invalid conflict policy %q, either %s, %s or %s", policy, ConflictSkip, ConflictOverwrite, ConflictFail)
+	}
+	remap := func(namespace string) string {
+		if ns, ok := namespaces[namespace]; ok {
+			return ns
+		}
+		return namespace
+	}
+
+	services := []*corev1.Service{}
+	for i := range archive.Services {
+		svc := archive.Services[i].DeepCopy()
+		svc.Namespace = remap(svc.Namespace)
+		services = append(services, svc)
+	}
+	ingresses := []*v1beta1.Ingress{}
+	for i := range archive.Ingresses {
+		in := archive.Ingresses[i].DeepCopy()
+		in.Namespace = remap(in.Namespace)
+		ingresses = append(ingresses, in)
+	}
+
+	// Look up all the existing resources first, so a failing import changes nothing
+	existingServices := map[*corev1.Service]*corev1.Service{}
+	existingIngresses := map[*v1beta1.Ingress]*v1beta1.Ingress{}
+	conflicts := []string{}
+	for _, svc := range services {
+		current, err := client.CoreV1().Services(svc.Namespace).Get(svc.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		existingServices[svc] = current
+		conflicts = append(conflicts, fmt.Sprintf("Service %s/%s", svc.Namespace, svc.Name))
+	}
+	for _, in := range ingresses {
+		current, err := client.ExtensionsV1beta1().Ingresses(in.Namespace).Get(in.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		existingIngresses[in] = current
+		conflicts = append(conflicts, fmt.Sprintf("Ingress %s/%s", in.Namespace, in.Name))
+	}
+	if policy == ConflictFail && len(conflicts) != 0 {
+		return result, fmt.Errorf("resources exist already: %v", conflicts)
+	}
+
+	for _, svc := range services {
+		name := fmt.Sprintf("Service %s/%s", svc.Namespace, svc.Name)
+		current, exists := existingServices[svc]
+		switch {
+		case !exists:
+			if _, err := client.CoreV1().Services(svc.Namespace).Create(svc); err != nil {
+				return result, err
+			}
+			result.Created = append(result.Created, name)
+		case policy == ConflictOverwrite:
+			updated := current.DeepCopy()
+			updated.Labels = mergeMaps(current.Labels, svc.Labels)
+			updated.Annotations = mergeMaps(current.Annotations, svc.Annotations)
+			// The cluster IP is immutable
+			clusterIP := updated.Spec.ClusterIP
+			updated.Spec = svc.Spec
+			updated.Spec.ClusterIP = clusterIP
+			if _, err := client.CoreV1().Services(svc.Namespace).Update(updated); err != nil {
+				return result, err
+			}
+			result.Updated = append(result.Updated, name)
+		default:
+			result.Skipped = append(result.Skipped, name)
+		}
+	}
+	for _, in := range ingresses {
+		name := fmt.Sprintf("Ingress %s/%s", in.Namespace, in.Name)
+		current, exists := existingIngresses[in]
+		switch {
+		case !exists:
+			if _, err := client.ExtensionsV1beta1().Ingresses(in.Namespace).Create(in); err != nil {
+				return result, err
+			}
+			result.Created = append(result.Created, name)
+		case policy == ConflictOverwrite:
+			updated := current.DeepCopy()
+			updated.Labels = mergeMaps(current.Labels, in.Labels)
+			updated.Annotations = mergeMaps(current.Annotations, in.Annotations)
+			updated.Spec = in.Spec
+			if _, err := client.ExtensionsV1beta1().Ingresses(in.Namespace).Update(updated); err != nil {
+				return result, err
+			}
+			result.Updated = append(result.Updated, name)
+		default:
+			result.Skipped = append(result.Skipped, name)
+		}
+	}
+	return result, nil
+}
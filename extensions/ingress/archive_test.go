@@ -0,0 +1,120 @@
+package ingress_test
+
+import (
+	"encoding/json"
+
+	eirinix "github.com/SUSE/eirinix"
+	. "github.com/mudler/eirini-ingress/extensions/ingress"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Route archive", func() {
+	var (
+		pw      *PodWatcher
+		client  *fake.Clientset
+		archive *RouteArchive
+	)
+
+	BeforeEach(func() {
+		pw = NewPodWatcher(nil, nil)
+		client = fake.NewSimpleClientset(
+			appPod("foo", "foo-guid", "0", `[{"hostname":"foo.example.com","port":8080}]`),
+			&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "eirini", Name: "other"}},
+			// Unlabeled, even if it looks generated for an app
+			&corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "eirini", Name: "legacy"},
+				Spec:       corev1.ServiceSpec{Selector: map[string]string{eirinix.LabelGUID: "legacy-guid"}},
+			},
+		)
+		changes, err := pw.Plan(client, "eirini")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pw.Apply(client, changes)).To(BeEmpty())
+
+		svc, err := client.CoreV1().Services("eirini").Get("foo", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		svc.ResourceVersion = "42"
+		svc.Spec.ClusterIP = "10.0.0.1"
+		_, err = client.CoreV1().Services("eirini").Update(svc)
+		Expect(err).ToNot(HaveOccurred())
+
+		// Only the labelled resources are exported, even when adopting the unlabeled ones
+		pw.AdoptUnlabeled = true
+		exported, err := pw.Export(client, "eirini")
+		Expect(err).ToNot(HaveOccurred())
+		// Archives are written as JSON
+		data, err := json.Marshal(exported)
+		Expect(err).ToNot(HaveOccurred())
+		archive = &RouteArchive{}
+		Expect(json.Unmarshal(data, archive)).To(Succeed())
+	})
+
+	It("exports the generated resources and the routes", func() {
+		Expect(archive.Version).To(Equal(RouteArchiveVersion))
+		Expect(archive.Namespace).To(Equal("eirini"))
+		Expect(archive.Services).To(HaveLen(1))
+		Expect(archive.Services[0].GetName()).To(Equal("foo"))
+		Expect(archive.Services[0].GetResourceVersion()).To(BeEmpty())
+		Expect(archive.Services[0].Spec.ClusterIP).To(BeEmpty())
+		Expect(archive.Ingresses).To(HaveLen(1))
+		Expect(archive.Routes).To(HaveLen(1))
+		Expect(archive.Routes[0].Hostname).To(Equal("foo.example.com"))
+	})
+
+	It("imports the resources in a remapped namespace", func() {
+		target := fake.NewSimpleClientset()
+		result, err := Import(target, archive, map[string]string{"eirini": "cf-apps"}, ConflictFail)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Created).To(Equal([]string{"Service cf-apps/foo", "Ingress cf-apps/foo"}))
+
+		svc, err := target.CoreV1().Services("cf-apps").Get("foo", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(svc.GetLabels()).To(HaveKeyWithValue(ManagedByLabel, ManagedBy))
+		_, err = target.ExtensionsV1beta1().Ingresses("cf-apps").Get("foo", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("handles the existing resources with the conflict policy", func() {
+		svc, err := client.CoreV1().Services("eirini").Get("foo", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		svc.Labels = map[string]string{"changed": "true"}
+		svc.Annotations = map[string]string{"kept": "true"}
+		_, err = client.CoreV1().Services("eirini").Update(svc)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(client.ExtensionsV1beta1().Ingresses("eirini").Delete("foo", nil)).To(Succeed())
+
+		_, err = Import(client, archive, nil, ConflictFail)
+		Expect(err).To(MatchError("resources exist already: [Service eirini/foo]"))
+		_, err = client.ExtensionsV1beta1().Ingresses("eirini").Get("foo", metav1.GetOptions{})
+		Expect(err).To(HaveOccurred())
+
+		result, err := Import(client, archive, nil, ConflictSkip)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Skipped).To(Equal([]string{"Service eirini/foo"}))
+		Expect(result.Created).To(Equal([]string{"Ingress eirini/foo"}))
+		svc, err = client.CoreV1().Services("eirini").Get("foo", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(svc.GetLabels()).To(Equal(map[string]string{"changed": "true"}))
+
+		result, err = Import(client, archive, nil, ConflictOverwrite)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Updated).To(Equal([]string{"Service eirini/foo", "Ingress eirini/foo"}))
+		svc, err = client.CoreV1().Services("eirini").Get("foo", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		// The labels and annotations set in the cluster are kept
+		Expect(svc.GetLabels()).To(Equal(map[string]string{"changed": "true", ManagedByLabel: ManagedBy}))
+		Expect(svc.GetAnnotations()).To(Equal(map[string]string{"kept": "true"}))
+		Expect(svc.Spec.ClusterIP).To(Equal("10.0.0.1"))
+	})
+
+	It("rejects invalid policies and versions", func() {
+		_, err := Import(client, archive, nil, "merge")
+		Expect(err).To(HaveOccurred())
+		archive.Version = 2
+		_, err = Import(client, archive, nil, ConflictSkip)
+		Expect(err).To(MatchError("unsupported archive version 2"))
+	})
+})
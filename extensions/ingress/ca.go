@@ -0,0 +1,356 @@
+package ingress
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	eirinix "github.com/SUSE/eirinix"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// IssuerLabel is the label set on the TLS secrets issued by the extension
+	IssuerLabel = "eirinix.suse.org/ingress-issuer"
+	// SelfSignedIssuer is the IssuerLabel value of the secrets signed by the SelfSignedCA
+	SelfSignedIssuer = "self-signed"
+
+	caValidity = 10 * 365 * 24 * time.Hour
+)
+
+// SelfSignedCA issues development certificates for Eirini apps.
+// The CA certificate and key are kept in a kubernetes secret, so all the replicas of the
+// extension sign with the same CA.
+type SelfSignedCA struct {
+	Namespace, SecretName string
+	// Validity is the lifetime of the issued certificates
+	Validity time.Duration
+	// RenewBefore is the time before expiry when certificates get renewed
+	RenewBefore time.Duration
+
+	mu   sync.Mutex
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+// NewSelfSignedCA returns a SelfSignedCA stored in the given secret
+func NewSelfSignedCA(namespace, secretName string) *SelfSignedCA {
+	return &SelfSignedCA{
+		Namespace:   namespace,
+		SecretName:  secretName,
+		Validity:    90 * 24 * time.Hour,
+		RenewBefore: 30 * 24 * time.Hour,
+	}
+}
+
+// Load reads the CA from its secret, generating a new one if it doesn't exist yet
+func (ca *SelfSignedCA) Load(client kubernetes.Interface) error {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	if ca.cert != nil {
+		return nil
+	}
+
+	secret, err := client.CoreV1().Secrets(ca.Namespace).Get(ca.SecretName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		secret, err = ca.generate(client)
+	}
+	if err != nil {
+		return err
+	}
+
+	cert, err := parseCertificate(secret.Data[corev1.TLSCertKey])
+	if err != nil {
+		return fmt.Errorf("invalid CA certificate in %s/%s: %s", ca.Namespace, ca.SecretName, err.Error())
+	}
+	block, _ := pem.Decode(secret.Data[corev1.TLSPrivateKeyKey])
+	if block == nil {
+		return fmt.Errorf("invalid CA key in %s/%s", ca.Namespace, ca.SecretName)
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("invalid CA key in %s/%s: %s", ca.Namespace, ca.SecretName, err.Error())
+	}
+
+	ca.cert, ca.key, ca.pem = cert, key, secret.Data[corev1.TLSCertKey]
+	return nil
+}
+
+func (ca *SelfSignedCA) generate(client kubernetes.Interface) (*corev1.Secret, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "eirini-ingress self-signed CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ca.SecretName,
+			Namespace: ca.Namespace,
+			Labels:    map[string]string{ManagedByLabel: ManagedBy},
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			corev1.TLSPrivateKeyKey: keyPEM,
+		},
+	}
+
+	created, err := client.CoreV1().Secrets(ca.Namespace).Create(secret)
+	if apierrors.IsAlreadyExists(err) {
+		// Another replica was faster, use its CA
+		return client.CoreV1().Secrets(ca.Namespace).Get(ca.SecretName, metav1.GetOptions{})
+	}
+	return created, err
+}
+
+// Issue returns a PEM encoded certificate and key for the given hosts, signed by the CA
+func (ca *SelfSignedCA) Issue(hosts []string) (certPEM, keyPEM []byte, err error) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	if ca.cert == nil {
+		return nil, nil, fmt.Errorf("CA not loaded")
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: hosts[0]},
+		DNSNames:     hosts,
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(ca.Validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err = encodeKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), keyPEM, nil
+}
+
+// EnsureSecret makes sure the TLS secret contains a valid certificate for the hosts.
+// The certificate is re-issued if it is missing, about to expire, not signed by the CA
+// or if the hosts changed. Secrets which were not issued by the CA are left untouched.
+func (ca *SelfSignedCA) EnsureSecret(client kubernetes.Interface, namespace, name string, hosts []string) (bool, error) {
+	if len(hosts) == 0 {
+		return false, nil
+	}
+	if err := ca.Load(client); err != nil {
+		return false, err
+	}
+	hosts = uniqueSorted(hosts)
+
+	secret, err := client.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+	create := apierrors.IsNotFound(err)
+	switch {
+	case create:
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels:    map[string]string{IssuerLabel: SelfSignedIssuer, ManagedByLabel: ManagedBy},
+			},
+			Type: corev1.SecretTypeTLS,
+		}
+	case err != nil:
+		return false, err
+	case secret.GetLabels()[IssuerLabel] != SelfSignedIssuer:
+		return false, nil
+	case !ca.needsRenewal(secret, hosts):
+		return false, nil
+	}
+
+	certPEM, keyPEM, err := ca.Issue(hosts)
+	if err != nil {
+		return false, err
+	}
+	secret.Data = map[string][]byte{
+		corev1.TLSCertKey:       certPEM,
+		corev1.TLSPrivateKeyKey: keyPEM,
+		"ca.crt":                ca.pem,
+	}
+
+	if create {
+		_, err = client.CoreV1().Secrets(namespace).Create(secret)
+	} else {
+		_, err = client.CoreV1().Secrets(namespace).Update(secret)
+	}
+	return err == nil, err
+}
+
+func (ca *SelfSignedCA) needsRenewal(secret *corev1.Secret, hosts []string) bool {
+	cert, err := parseCertificate(secret.Data[corev1.TLSCertKey])
+	if err != nil {
+		return true
+	}
+	if time.Now().Add(ca.RenewBefore).After(cert.NotAfter) {
+		return true
+	}
+	if cert.CheckSignatureFrom(ca.cert) != nil {
+		return true
+	}
+
+	current := uniqueSorted(cert.DNSNames)
+	if len(current) != len(hosts) {
+		return true
+	}
+	for i := range hosts {
+		if current[i] != hosts[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// Renew re-issues all the certificates of the namespace which are about to expire
+func (ca *SelfSignedCA) Renew(client kubernetes.Interface, namespace string) error {
+	set := labels.Set{IssuerLabel: SelfSignedIssuer}
+	secrets, err := client.CoreV1().Secrets(namespace).List(metav1.ListOptions{LabelSelector: set.AsSelector().String()})
+	if err != nil {
+		return err
+	}
+
+	for _, secret := range secrets.Items {
+		cert, err := parseCertificate(secret.Data[corev1.TLSCertKey])
+		if err != nil {
+			continue
+		}
+		if _, err := ca.EnsureSecret(client, namespace, secret.GetName(), cert.DNSNames); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Prune deletes the certificates issued in the namespace which are no longer referenced by any
+// ingress, e.g. after the app was deleted while the watcher was not running
+func (ca *SelfSignedCA) Prune(client kubernetes.Interface, namespace string) error {
+	set := labels.Set{IssuerLabel: SelfSignedIssuer}
+	secrets, err := client.CoreV1().Secrets(namespace).List(metav1.ListOptions{LabelSelector: set.AsSelector().String()})
+	if err != nil || len(secrets.Items) == 0 {
+		return err
+	}
+
+	ingresses, err := client.ExtensionsV1beta1().Ingresses(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	referenced := map[string]interface{}{}
+	for _, in := range ingresses.Items {
+		for _, t := range in.Spec.TLS {
+			referenced[t.SecretName] = nil
+		}
+	}
+
+	for _, secret := range secrets.Items {
+		if _, ok := referenced[secret.GetName()]; ok {
+			continue
+		}
+		if namespace == ca.Namespace && secret.GetName() == ca.SecretName {
+			continue
+		}
+		if err := client.CoreV1().Secrets(namespace).Delete(secret.GetName(), nil); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		fmt.Println("Deleted certificate", secret.GetName())
+	}
+	return nil
+}
+
+// Run periodically renews the certificates in the namespace until stop is closed
+func (ca *SelfSignedCA) Run(manager eirinix.Manager, namespace string, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		clientset, err := getClientSet(manager)
+		if err == nil {
+			err = ca.Renew(clientset, namespace)
+		}
+		if err != nil {
+			manager.GetLogger().Error("Failed renewing certificates: ", err.Error())
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func encodeKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+func uniqueSorted(list []string) []string {
+	res := []string{}
+	for _, s := range list {
+		if !containsString(res, s) {
+			res = append(res, s)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
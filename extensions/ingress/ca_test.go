@@ -0,0 +1,84 @@
+package ingress_test
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"time"
+
+	. "github.com/mudler/eirini-ingress/extensions/ingress"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func decodeCert(data []byte) *x509.Certificate {
+	block, _ := pem.Decode(data)
+	Expect(block).ToNot(BeNil())
+	cert, err := x509.ParseCertificate(block.Bytes)
+	Expect(err).ToNot(HaveOccurred())
+	return cert
+}
+
+var _ = Describe("Self-signed CA", func() {
+	var (
+		client *fake.Clientset
+		ca     *SelfSignedCA
+	)
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		ca = NewSelfSignedCA("eirini", "eirini-ingress-ca")
+	})
+
+	It("creates the CA secret and issues certificates for the hosts", func() {
+		issued, err := ca.EnsureSecret(client, "eirini", "foo-tls", []string{"foo.example.com", "bar.example.com"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(issued).To(BeTrue())
+
+		caSecret, err := client.CoreV1().Secrets("eirini").Get("eirini-ingress-ca", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		caCert := decodeCert(caSecret.Data[corev1.TLSCertKey])
+		Expect(caCert.IsCA).To(BeTrue())
+
+		secret, err := client.CoreV1().Secrets("eirini").Get("foo-tls", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(secret.Type).To(Equal(corev1.SecretTypeTLS))
+		Expect(secret.Labels[IssuerLabel]).To(Equal(SelfSignedIssuer))
+		cert := decodeCert(secret.Data[corev1.TLSCertKey])
+		Expect(cert.DNSNames).To(Equal([]string{"bar.example.com", "foo.example.com"}))
+		Expect(cert.CheckSignatureFrom(caCert)).ToNot(HaveOccurred())
+	})
+
+	It("re-issues only when hosts change or the certificate expires", func() {
+		_, err := ca.EnsureSecret(client, "eirini", "foo-tls", []string{"foo.example.com"})
+		Expect(err).ToNot(HaveOccurred())
+
+		issued, err := ca.EnsureSecret(client, "eirini", "foo-tls", []string{"foo.example.com"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(issued).To(BeFalse())
+
+		issued, err = ca.EnsureSecret(client, "eirini", "foo-tls", []string{"foo.example.com", "baz.example.com"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(issued).To(BeTrue())
+
+		ca.RenewBefore = ca.Validity + time.Hour
+		Expect(ca.Renew(client, "eirini")).To(Succeed())
+		secret, err := client.CoreV1().Secrets("eirini").Get("foo-tls", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(decodeCert(secret.Data[corev1.TLSCertKey]).DNSNames).To(Equal([]string{"baz.example.com", "foo.example.com"}))
+	})
+
+	It("does not overwrite secrets it did not issue", func() {
+		_, err := client.CoreV1().Secrets("eirini").Create(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo-tls", Namespace: "eirini"},
+			Data:       map[string][]byte{"tls.crt": []byte("custom")},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		issued, err := ca.EnsureSecret(client, "eirini", "foo-tls", []string{"foo.example.com"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(issued).To(BeFalse())
+	})
+})
@@ -0,0 +1,240 @@
+package ingress
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	eirinix "github.com/SUSE/eirinix"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// CredHubIssuer is the IssuerLabel value of the secrets written from CredHub certificates
+const CredHubIssuer = "credhub"
+
+// CredHubCertificate is a certificate credential stored in CredHub
+type CredHubCertificate struct {
+	CA          string `json:"ca"`
+	Certificate string `json:"certificate"`
+	PrivateKey  string `json:"private_key"`
+}
+
+// CredHubClient reads certificates from a CredHub compatible API.
+// Requests are authenticated with Token, or with a token obtained from the UAA
+// advertised by CredHub with the ClientID and ClientSecret credentials.
+type CredHubClient struct {
+	URL                    string
+	Token                  string
+	ClientID, ClientSecret string
+	HTTPClient             *http.Client
+
+	mu      sync.Mutex
+	expires time.Time
+}
+
+// NewCredHubClient returns a CredHubClient for the given API url. If caCert is
+// not empty, it is used to verify the server certificates.
+func NewCredHubClient(apiURL string, caCert []byte) (*CredHubClient, error) {
+	client := &CredHubClient{URL: strings.TrimSuffix(apiURL, "/"), HTTPClient: &http.Client{Timeout: 30 * time.Second}}
+	if len(caCert) != 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("invalid CredHub CA certificate")
+		}
+		client.HTTPClient.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	}
+	return client, nil
+}
+
+func (c *CredHubClient) getJSON(req *http.Request, v interface{}) error {
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s %s: %s %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (c *CredHubClient) token() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ClientID == "" || time.Now().Before(c.expires) {
+		return c.Token, nil
+	}
+
+	var info struct {
+		AuthServer struct {
+			URL string `json:"url"`
+		} `json:"auth-server"`
+	}
+	req, err := http.NewRequest(http.MethodGet, c.URL+"/info", nil)
+	if err != nil {
+		return "", err
+	}
+	if err := c.getJSON(req, &info); err != nil {
+		return "", err
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req, err = http.NewRequest(http.MethodPost, strings.TrimSuffix(info.AuthServer.URL, "/")+"/oauth/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(c.ClientID, c.ClientSecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := c.getJSON(req, &token); err != nil {
+		return "", err
+	}
+
+	c.Token = token.AccessToken
+	// Refresh a bit earlier than needed
+	c.expires = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second * 9 / 10)
+	return c.Token, nil
+}
+
+// GetCertificate returns the current value of the certificate credential at path
+func (c *CredHubClient) GetCertificate(path string) (*CredHubCertificate, error) {
+	token, err := c.token()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, c.URL+"/api/v1/data?"+url.Values{"name": {path}, "current": {"true"}}.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "bearer "+token)
+	}
+
+	var data struct {
+		Data []struct {
+			Type  string             `json:"type"`
+			Value CredHubCertificate `json:"value"`
+		} `json:"data"`
+	}
+	if err := c.getJSON(req, &data); err != nil {
+		return nil, err
+	}
+	if len(data.Data) == 0 {
+		return nil, fmt.Errorf("credential %s not found", path)
+	}
+	if data.Data[0].Type != "certificate" {
+		return nil, fmt.Errorf("credential %s is a %s, not a certificate", path, data.Data[0].Type)
+	}
+	return &data.Data[0].Value, nil
+}
+
+// CredHubSecretName returns the name of the secret for a domain without a shared TLS secret
+func CredHubSecretName(domain string) string {
+	name := strings.Replace(strings.TrimPrefix(domain, "*."), ".", "-", -1)
+	if strings.HasPrefix(domain, "*.") {
+		name = "wildcard-" + name
+	}
+	return strings.ToLower(name) + "-tls"
+}
+
+// CredHubSync writes the certificates stored in CredHub to kubernetes TLS secrets
+type CredHubSync struct {
+	Client *CredHubClient
+	// Paths maps the secret names to the path of the certificate in CredHub
+	Paths map[string]string
+}
+
+// NewCredHubSync returns a CredHubSync for the given secret to CredHub path mapping
+func NewCredHubSync(client *CredHubClient, paths map[string]string) *CredHubSync {
+	return &CredHubSync{Client: client, Paths: paths}
+}
+
+// Sync writes the current CredHub certificates into the secrets of the namespace.
+// Existing secrets which were not written from CredHub are left untouched.
+func (s *CredHubSync) Sync(client kubernetes.Interface, namespace string) error {
+	errs := []string{}
+	for name, path := range s.Paths {
+		if err := s.sync(client, namespace, name, path); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", name, err.Error()))
+		}
+	}
+	if len(errs) != 0 {
+		return fmt.Errorf("syncing CredHub certificates: %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+func (s *CredHubSync) sync(client kubernetes.Interface, namespace, name, path string) error {
+	cert, err := s.Client.GetCertificate(path)
+	if err != nil {
+		return err
+	}
+	data := map[string][]byte{
+		corev1.TLSCertKey:       []byte(cert.Certificate),
+		corev1.TLSPrivateKeyKey: []byte(cert.PrivateKey),
+	}
+	if cert.CA != "" {
+		data["ca.crt"] = []byte(cert.CA)
+	}
+
+	secret, err := client.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = client.CoreV1().Secrets(namespace).Create(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels:    map[string]string{IssuerLabel: CredHubIssuer, ManagedByLabel: ManagedBy},
+			},
+			Type: corev1.SecretTypeTLS,
+			Data: data,
+		})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if secret.GetLabels()[IssuerLabel] != CredHubIssuer || reflect.DeepEqual(secret.Data, data) {
+		return nil
+	}
+
+	secret.Data = data
+	_, err = client.CoreV1().Secrets(namespace).Update(secret)
+	return err
+}
+
+// Run periodically refreshes the secrets in the namespace until stop is closed
+func (s *CredHubSync) Run(manager eirinix.Manager, namespace string, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		clientset, err := getClientSet(manager)
+		if err == nil {
+			err = s.Sync(clientset, namespace)
+		}
+		if err != nil {
+			manager.GetLogger().Error(err.Error())
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package ingress_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/mudler/eirini-ingress/extensions/ingress"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("CredHub", func() {
+	var (
+		server      *httptest.Server
+		credhub     *CredHubClient
+		certificate string
+	)
+
+	BeforeEach(func() {
+		certificate = "cert-v1"
+		mux := http.NewServeMux()
+		mux.HandleFunc("/info", func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(map[string]interface{}{"auth-server": map[string]string{"url": server.URL + "/uaa"}})
+		})
+		mux.HandleFunc("/uaa/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+			user, pass, _ := r.BasicAuth()
+			if user != "client" || pass != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "token", "expires_in": 3600})
+		})
+		mux.HandleFunc("/api/v1/data", func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "bearer token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.URL.Query().Get("name") != "/certs/apps" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": []interface{}{
+				map[string]interface{}{
+					"type":  "certificate",
+					"value": map[string]string{"ca": "ca", "certificate": certificate, "private_key": "key"},
+				},
+			}})
+		})
+		server = httptest.NewServer(mux)
+
+		var err error
+		credhub, err = NewCredHubClient(server.URL, nil)
+		Expect(err).ToNot(HaveOccurred())
+		credhub.ClientID = "client"
+		credhub.ClientSecret = "secret"
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("reads certificates with UAA client credentials", func() {
+		cert, err := credhub.GetCertificate("/certs/apps")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cert.Certificate).To(Equal("cert-v1"))
+		Expect(cert.PrivateKey).To(Equal("key"))
+
+		_, err = credhub.GetCertificate("/certs/missing")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("writes and refreshes the TLS secrets", func() {
+		client := fake.NewSimpleClientset()
+		sync := NewCredHubSync(credhub, map[string]string{CredHubSecretName("*.apps.example.com"): "/certs/apps"})
+
+		Expect(sync.Sync(client, "eirini")).To(Succeed())
+		secret, err := client.CoreV1().Secrets("eirini").Get("wildcard-apps-example-com-tls", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(secret.Type).To(Equal(corev1.SecretTypeTLS))
+		Expect(string(secret.Data[corev1.TLSCertKey])).To(Equal("cert-v1"))
+
+		certificate = "cert-v2"
+		Expect(sync.Sync(client, "eirini")).To(Succeed())
+		secret, err = client.CoreV1().Secrets("eirini").Get("wildcard-apps-example-com-tls", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(secret.Data[corev1.TLSCertKey])).To(Equal("cert-v2"))
+	})
+})
@@ -0,0 +1,289 @@
+package ingress
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	eirinix "github.com/SUSE/eirinix"
+	"golang.org/x/net/dns/dnsmessage"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DNSServer is an authoritative DNS server for the route hostnames in the RouteTable.
+// Hostnames served by an app resolve to the ingress controller addresses, while unknown
+// names inside the managed zones get NXDOMAIN. Queries outside the zones are refused.
+type DNSServer struct {
+	Routes *RouteTable
+	// Zones are the managed DNS zones (e.g. `apps.example.com`)
+	Zones []string
+	// Addresses are the ingress controller addresses the hostnames resolve to. If empty, they
+	// resolve to the load balancer address of the Ingress of their app (see SyncIngressAddresses).
+	Addresses []net.IP
+	TTL       uint32
+
+	mu sync.RWMutex
+	// ingresses are the load balancer addresses of the Ingresses, by namespace/name
+	ingresses map[string]dnsTargets
+}
+
+// dnsTargets are the load balancer addresses of an Ingress
+type dnsTargets struct {
+	IPs []net.IP
+	// Hostnames are the load balancers known by name only, answered with a CNAME
+	Hostnames []string
+}
+
+// NewDNSServer returns a DNSServer for the route table
+func NewDNSServer(routes *RouteTable, zones []string, addresses []net.IP) *DNSServer {
+	return &DNSServer{Routes: routes, Zones: zones, Addresses: addresses, TTL: 30, ingresses: map[string]dnsTargets{}}
+}
+
+// targets returns the addresses the hostnames of the app resolve to
+func (s *DNSServer) targets(app AppRoutes) dnsTargets {
+	if len(s.Addresses) != 0 {
+		return dnsTargets{IPs: s.Addresses}
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ingresses[appKey(app.Namespace, app.Ingress)]
+}
+
+// SyncIngressAddresses reads the load balancer addresses of the Ingresses generated in the namespace
+func (s *DNSServer) SyncIngressAddresses(client kubernetes.Interface, namespace string) error {
+	selector := labels.Set{ManagedByLabel: ManagedBy}.AsSelector().String()
+	ingresses, err := client.ExtensionsV1beta1().Ingresses(namespace).List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key := range s.ingresses {
+		if strings.HasPrefix(key, namespace+"/") {
+			delete(s.ingresses, key)
+		}
+	}
+	for _, in := range ingresses.Items {
+		t := dnsTargets{}
+		for _, address := range loadBalancerAddresses(&in) {
+			if ip := net.ParseIP(address); ip != nil {
+				t.IPs = append(t.IPs, ip)
+			} else {
+				t.Hostnames = append(t.Hostnames, address)
+			}
+		}
+		s.ingresses[appKey(namespace, in.GetName())] = t
+	}
+	return nil
+}
+
+// RunIngressAddresses syncs the load balancer addresses of the Ingresses in the namespace every
+// interval, until stop is closed. It is only needed without Addresses.
+func (s *DNSServer) RunIngressAddresses(manager eirinix.Manager, namespace string, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		clientset, err := getClientSet(manager)
+		if err == nil {
+			err = s.SyncIngressAddresses(clientset, namespace)
+		}
+		if err != nil {
+			manager.GetLogger().Error("Failed reading the ingress addresses: ", err.Error())
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// zone returns the managed zone containing the name
+func (s *DNSServer) zone(name string) (string, bool) {
+	best := ""
+	for _, z := range s.Zones {
+		z = strings.ToLower(strings.Trim(z, "."))
+		if (name == z || strings.HasSuffix(name, "."+z)) && len(z) > len(best) {
+			best = z
+		}
+	}
+	return best, best != ""
+}
+
+// Answer returns the response to the DNS query in wire format
+func (s *DNSServer) Answer(query []byte) ([]byte, error) {
+	var p dnsmessage.Parser
+	header, err := p.Start(query)
+	if err != nil {
+		return nil, err
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil, err
+	}
+
+	header.Response = true
+	header.Authoritative = true
+	header.RecursionAvailable = false
+	header.RCode = dnsmessage.RCodeSuccess
+
+	name := strings.ToLower(strings.TrimSuffix(q.Name.String(), "."))
+	app, served := s.Routes.Lookup(name)
+	zone, managed := s.zone(name)
+	switch {
+	case served:
+	case managed && name == zone:
+		// The zone apex exists, but has no records
+	case managed:
+		header.RCode = dnsmessage.RCodeNameError
+	default:
+		header.Authoritative = false
+		header.RCode = dnsmessage.RCodeRefused
+	}
+
+	b := dnsmessage.NewBuilder(make([]byte, 0, 512), header)
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(q); err != nil {
+		return nil, err
+	}
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+
+	answered := false
+	if served && q.Class == dnsmessage.ClassINET {
+		rh := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: s.TTL}
+		targets := s.targets(app)
+		for _, ip := range targets.IPs {
+			switch {
+			case q.Type == dnsmessage.TypeA && ip.To4() != nil:
+				var a dnsmessage.AResource
+				copy(a.A[:], ip.To4())
+				err = b.AResource(rh, a)
+				answered = true
+			case q.Type == dnsmessage.TypeAAAA && ip.To4() == nil && ip.To16() != nil:
+				var aaaa dnsmessage.AAAAResource
+				copy(aaaa.AAAA[:], ip.To16())
+				err = b.AAAAResource(rh, aaaa)
+				answered = true
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		// A name can only have one CNAME, and no other record
+		if len(targets.IPs) == 0 && len(targets.Hostnames) != 0 {
+			cname, err := dnsmessage.NewName(strings.TrimSuffix(targets.Hostnames[0], ".") + ".")
+			if err != nil {
+				return nil, err
+			}
+			if err := b.CNAMEResource(rh, dnsmessage.CNAMEResource{CNAME: cname}); err != nil {
+				return nil, err
+			}
+			answered = true
+		}
+	}
+
+	// Negative answers carry the zone SOA, so resolvers can cache them
+	if !answered && managed {
+		if err := b.StartAuthorities(); err != nil {
+			return nil, err
+		}
+		if err := b.SOAResource(dnsmessage.ResourceHeader{
+			Name:  dnsmessage.MustNewName(zone + "."),
+			Class: dnsmessage.ClassINET,
+			TTL:   s.TTL,
+		}, dnsmessage.SOAResource{
+			NS:      dnsmessage.MustNewName("ns." + zone + "."),
+			MBox:    dnsmessage.MustNewName("hostmaster." + zone + "."),
+			Serial:  1,
+			Refresh: 3600,
+			Retry:   600,
+			Expire:  86400,
+			MinTTL:  s.TTL,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return b.Finish()
+}
+
+// ListenAndServe serves DNS on the address over both UDP and TCP. It blocks until one of the listeners fails.
+func (s *DNSServer) ListenAndServe(manager eirinix.Manager, addr string) error {
+	udp, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer udp.Close()
+	tcp, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer tcp.Close()
+
+	errs := make(chan error, 2)
+	go func() { errs <- s.serveUDP(manager, udp) }()
+	go func() { errs <- s.serveTCP(manager, tcp) }()
+	return <-errs
+}
+
+func (s *DNSServer) serveUDP(manager eirinix.Manager, conn net.PacketConn) error {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		resp, err := s.Answer(buf[:n])
+		if err != nil {
+			manager.GetLogger().Debug("Invalid DNS query from ", addr, ": ", err.Error())
+			continue
+		}
+		conn.WriteTo(resp, addr)
+	}
+}
+
+func (s *DNSServer) serveTCP(manager eirinix.Manager, l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			for {
+				// TCP messages are prefixed with their length
+				var size uint16
+				if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+					return
+				}
+				query := make([]byte, size)
+				if _, err := io.ReadFull(conn, query); err != nil {
+					return
+				}
+				resp, err := s.Answer(query)
+				if err != nil {
+					manager.GetLogger().Debug("Invalid DNS query from ", conn.RemoteAddr(), ": ", err.Error())
+					return
+				}
+				if err := binary.Write(conn, binary.BigEndian, uint16(len(resp))); err != nil {
+					return
+				}
+				if _, err := conn.Write(resp); err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
@@ -0,0 +1,118 @@
+package ingress_test
+
+import (
+	"net"
+
+	eirinix "github.com/SUSE/eirinix"
+	. "github.com/mudler/eirini-ingress/extensions/ingress"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/dns/dnsmessage"
+	corev1 "k8s.io/api/core/v1"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func query(server *DNSServer, name string, t dnsmessage.Type) dnsmessage.Message {
+	q := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: 42, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName(name), Type: t, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := q.Pack()
+	Expect(err).ToNot(HaveOccurred())
+	resp, err := server.Answer(packed)
+	Expect(err).ToNot(HaveOccurred())
+
+	var m dnsmessage.Message
+	Expect(m.Unpack(resp)).To(Succeed())
+	Expect(m.Header.ID).To(Equal(uint16(42)))
+	return m
+}
+
+var _ = Describe("DNS server", func() {
+	var (
+		routes *RouteTable
+		server *DNSServer
+		pod    *corev1.Pod
+	)
+
+	BeforeEach(func() {
+		routes = NewRouteTable()
+		server = NewDNSServer(routes, []string{"apps.example.com"}, []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("fd00::1")})
+		pod = &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "eirini",
+				Name:      "foo-0",
+				Labels:    map[string]string{eirinix.LabelGUID: "guid"},
+				Annotations: map[string]string{
+					AppNameAnnotation: "foo",
+					RoutesAnnotation:  `[{"hostname":"foo.apps.example.com","port":8080}]`,
+				},
+			},
+		}
+		routes.Update(NewEiriniApp(pod), pod, "foo", "foo")
+	})
+
+	It("answers for the routed hostnames", func() {
+		m := query(server, "foo.apps.example.com.", dnsmessage.TypeA)
+		Expect(m.Header.RCode).To(Equal(dnsmessage.RCodeSuccess))
+		Expect(m.Header.Authoritative).To(BeTrue())
+		Expect(m.Answers).To(HaveLen(1))
+		Expect(m.Answers[0].Body.(*dnsmessage.AResource).A).To(Equal([4]byte{10, 0, 0, 1}))
+
+		m = query(server, "FOO.apps.example.com.", dnsmessage.TypeAAAA)
+		Expect(m.Answers).To(HaveLen(1))
+		Expect(net.IP(m.Answers[0].Body.(*dnsmessage.AAAAResource).AAAA[:]).String()).To(Equal("fd00::1"))
+	})
+
+	It("returns NXDOMAIN for unknown names in the zone and follows route changes", func() {
+		m := query(server, "bar.apps.example.com.", dnsmessage.TypeA)
+		Expect(m.Header.RCode).To(Equal(dnsmessage.RCodeNameError))
+		Expect(m.Authorities).To(HaveLen(1))
+
+		routes.Delete(NewEiriniApp(pod), pod)
+		m = query(server, "foo.apps.example.com.", dnsmessage.TypeA)
+		Expect(m.Header.RCode).To(Equal(dnsmessage.RCodeNameError))
+	})
+
+	It("refuses names outside the managed zones", func() {
+		m := query(server, "example.org.", dnsmessage.TypeA)
+		Expect(m.Header.RCode).To(Equal(dnsmessage.RCodeRefused))
+	})
+
+	It("resolves to the load balancer of the ingress without targets", func() {
+		server = NewDNSServer(routes, []string{"apps.example.com"}, nil)
+		in := &v1beta1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "eirini", Name: "foo", Labels: map[string]string{ManagedByLabel: ManagedBy}},
+			Status: v1beta1.IngressStatus{LoadBalancer: corev1.LoadBalancerStatus{
+				Ingress: []corev1.LoadBalancerIngress{{IP: "10.0.0.2"}},
+			}},
+		}
+		client := fake.NewSimpleClientset(in)
+
+		// Unknown until the addresses are read
+		m := query(server, "foo.apps.example.com.", dnsmessage.TypeA)
+		Expect(m.Header.RCode).To(Equal(dnsmessage.RCodeSuccess))
+		Expect(m.Answers).To(BeEmpty())
+
+		Expect(server.SyncIngressAddresses(client, "eirini")).To(Succeed())
+		m = query(server, "foo.apps.example.com.", dnsmessage.TypeA)
+		Expect(m.Answers).To(HaveLen(1))
+		Expect(m.Answers[0].Body.(*dnsmessage.AResource).A).To(Equal([4]byte{10, 0, 0, 2}))
+
+		// Load balancers known by hostname only
+		in.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{Hostname: "lb.example.com"}}
+		_, err := client.ExtensionsV1beta1().Ingresses("eirini").UpdateStatus(in)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(server.SyncIngressAddresses(client, "eirini")).To(Succeed())
+		m = query(server, "foo.apps.example.com.", dnsmessage.TypeA)
+		Expect(m.Answers).To(HaveLen(1))
+		Expect(m.Answers[0].Body.(*dnsmessage.CNAMEResource).CNAME.String()).To(Equal("lb.example.com."))
+
+		Expect(client.ExtensionsV1beta1().Ingresses("eirini").Delete("foo", nil)).To(Succeed())
+		Expect(server.SyncIngressAddresses(client, "eirini")).To(Succeed())
+		m = query(server, "foo.apps.example.com.", dnsmessage.TypeA)
+		Expect(m.Answers).To(BeEmpty())
+	})
+})
@@ -0,0 +1,137 @@
+package ingress
+
+import (
+	"fmt"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Permission is an access to the Kubernetes API needed by the extension
+type Permission struct {
+	Namespace string   `json:"namespace"`
+	Group     string   `json:"group"`
+	Resource  string   `json:"resource"`
+	Verbs     []string `json:"verbs"`
+	// Reason is the feature needing the permission
+	Reason string `json:"reason"`
+}
+
+// CheckResult is the outcome of a check of the cluster
+type CheckResult struct {
+	Check   string `json:"check"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message"`
+	// Hint explains how to fix a failed check
+	Hint string `json:"hint,omitempty"`
+}
+
+// APIResource is a resource the extension needs to be served by the cluster
+type APIResource struct {
+	schema.GroupVersionResource
+	// Required is false for resources checked only to report what the cluster supports
+	Required bool
+	// Hint explains how to fix the missing resource
+	Hint string
+}
+
+// CheckPermissions verifies the permissions with SelfSubjectAccessReviews, one for each verb
+func CheckPermissions(client kubernetes.Interface, permissions []Permission) ([]CheckResult, error) {
+	results := []CheckResult{}
+	for _, p := range permissions {
+		resource := p.Resource
+		if p.Group != "" {
+			resource += "." + p.Group
+		}
+		for _, verb := range p.Verbs {
+			review, err := client.AuthorizationV1().SelfSubjectAccessReviews().Create(&authorizationv1.SelfSubjectAccessReview{
+				Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+					ResourceAttributes: &authorizationv1.ResourceAttributes{
+						Namespace: p.Namespace,
+						Verb:      verb,
+						Group:     p.Group,
+						Resource:  p.Resource,
+					},
+				},
+			})
+			if err != nil {
+				return nil, err
+			}
+			result := CheckResult{
+				Check:   fmt.Sprintf("%s %s in %s", verb, resource, p.Namespace),
+				Passed:  review.Status.Allowed,
+				Message: p.Reason,
+			}
+			if !result.Passed {
+				if review.Status.Reason != "" {
+					result.Message += ": " + review.Status.Reason
+				}
+				result.Hint = fmt.Sprintf("grant %s on %s in the namespace %s to the service account of the extension, e.g. applying the Role generated by `eirini-ingress manifests` with the same flags",
+					verb, resource, p.Namespace)
+			}
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// CheckAPIResources verifies the resources are served by the cluster
+func CheckAPIResources(client discovery.DiscoveryInterface, resources []APIResource) ([]CheckResult, error) {
+	groups, err := client.ServerGroups()
+	if err != nil {
+		return nil, err
+	}
+	served := map[string]interface{}{}
+	for _, g := range groups.Groups {
+		for _, v := range g.Versions {
+			served[v.GroupVersion] = nil
+		}
+	}
+
+	results := []CheckResult{}
+	for _, r := range resources {
+		gv := r.GroupVersion().String()
+		result := CheckResult{Check: fmt.Sprintf("%s %s", gv, r.Resource)}
+
+		if _, ok := served[gv]; ok {
+			list, err := client.ServerResourcesForGroupVersion(gv)
+			if err != nil {
+				return nil, err
+			}
+			for _, res := range list.APIResources {
+				if res.Name == r.Resource {
+					result.Passed = true
+					break
+				}
+			}
+		}
+
+		switch {
+		case result.Passed:
+			result.Message = "served by the cluster"
+		case r.Required:
+			result.Message = "not served by the cluster"
+			result.Hint = r.Hint
+		default:
+			// Missing optional resources are only informative
+			result.Passed = true
+			result.Message = "not served by the cluster (not required)"
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// IngressAPIResources are the Ingress API versions checked by the doctor. The extension generates
+// extensions/v1beta1 Ingresses, the other versions are reported for information.
+var IngressAPIResources = []APIResource{
+	{
+		GroupVersionResource: schema.GroupVersionResource{Group: "extensions", Version: "v1beta1", Resource: "ingresses"},
+		Required:             true,
+		Hint:                 "the generated Ingresses use extensions/v1beta1, which is not served since Kubernetes 1.22",
+	},
+	{GroupVersionResource: schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1beta1", Resource: "ingresses"}},
+	{GroupVersionResource: schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}},
+}
@@ -0,0 +1,68 @@
+package ingress_test
+
+import (
+	. "github.com/mudler/eirini-ingress/extensions/ingress"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var _ = Describe("Doctor", func() {
+	var client *fake.Clientset
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+	})
+
+	It("checks each verb with a SelfSubjectAccessReview", func() {
+		client.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+			attributes := review.Spec.ResourceAttributes
+			review.Status.Allowed = attributes.Namespace == "eirini" && attributes.Verb != "delete"
+			if !review.Status.Allowed {
+				review.Status.Reason = "no RBAC policy matched"
+			}
+			return true, review, nil
+		})
+
+		results, err := CheckPermissions(client, []Permission{
+			{Namespace: "eirini", Resource: "services", Verbs: []string{"get", "delete"}, Reason: "generating the Services"},
+			{Namespace: "platform", Resource: "secrets", Verbs: []string{"get"}, Reason: "replicating the TLS secrets"},
+			{Namespace: "eirini", Group: "extensions", Resource: "ingresses", Verbs: []string{"create"}, Reason: "generating the Ingresses"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(results).To(HaveLen(4))
+
+		Expect(results[0]).To(Equal(CheckResult{Check: "get services in eirini", Passed: true, Message: "generating the Services"}))
+		Expect(results[1].Check).To(Equal("delete services in eirini"))
+		Expect(results[1].Passed).To(BeFalse())
+		Expect(results[1].Message).To(Equal("generating the Services: no RBAC policy matched"))
+		Expect(results[1].Hint).To(ContainSubstring("grant delete on services in the namespace eirini"))
+		Expect(results[1].Hint).To(ContainSubstring("eirini-ingress manifests"))
+		Expect(results[2].Passed).To(BeFalse())
+		Expect(results[3].Check).To(Equal("create ingresses.extensions in eirini"))
+		Expect(results[3].Passed).To(BeTrue())
+	})
+
+	It("checks the API resources served by the cluster", func() {
+		client.Discovery().(*fakediscovery.FakeDiscovery).Resources = []*metav1.APIResourceList{
+			{GroupVersion: "extensions/v1beta1", APIResources: []metav1.APIResource{{Name: "ingresses"}}},
+			{GroupVersion: "networking.k8s.io/v1beta1", APIResources: []metav1.APIResource{{Name: "ingresses"}}},
+		}
+
+		dnsEndpoints := APIResource{GroupVersionResource: DNSEndpointResource, Required: true, Hint: "install the CRD"}
+		results, err := CheckAPIResources(client.Discovery(), append(IngressAPIResources, dnsEndpoints))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(results).To(Equal([]CheckResult{
+			{Check: "extensions/v1beta1 ingresses", Passed: true, Message: "served by the cluster"},
+			{Check: "networking.k8s.io/v1beta1 ingresses", Passed: true, Message: "served by the cluster"},
+			{Check: "networking.k8s.io/v1 ingresses", Passed: true, Message: "not served by the cluster (not required)"},
+			{Check: "externaldns.k8s.io/v1alpha1 dnsendpoints", Passed: false, Message: "not served by the cluster", Hint: "install the CRD"},
+		}))
+	})
+})
@@ -20,6 +20,17 @@ const (
 	AnnotationCopyKubernetesGenericLabels = "eirinix.suse.org/CopyKubeGenericLabels"
 	// RoutesAnnotation is the annotation label containing the Eirini application routes
 	RoutesAnnotation = "cloudfoundry.org/routes"
+	// RouteServicesAnnotation is the annotation containing the route service URLs by hostname
+	// ( json form '{ "app.example.com": "https://auth.example.com" }' )
+	RouteServicesAnnotation = "eirinix.suse.org/route-services"
+	// InstanceServiceLabel is the label containing the app name on the per-instance services
+	InstanceServiceLabel = "eirinix.suse.org/instance-of"
+	// PodNameLabel is the label StatefulSets set on their pods with the pod name
+	PodNameLabel = "statefulset.kubernetes.io/pod-name"
+	// ManagedByLabel is the label marking the resources created by the extension
+	ManagedByLabel = "eirinix.suse.org/managed-by"
+	// ManagedBy is the value of ManagedByLabel
+	ManagedBy = "eirini-ingress"
 )
 
 var (
@@ -40,12 +51,17 @@ type EiriniApp struct {
 	Annotations                 map[string]string
 	CopyKubernetesGenericLabels string
 	Routes                      []Route
+	// TLSSecrets maps domains (e.g. `*.apps.example.com`) to shared TLS secrets.
+	// Hostnames which don't match any domain fall back to the per-app secret.
+	TLSSecrets map[string]string
 }
 
 // Route represent a route information (hostname/port)
 type Route struct {
 	Hostname string
 	Port     int
+	// RouteServiceURL is the URL of the route service bound to the route, if any
+	RouteServiceURL string `json:"route_service_url,omitempty"`
 }
 
 // NewEiriniApp returns a EiriniApp from a corev1.Pod
@@ -65,17 +81,62 @@ func NewEiriniApp(pod *corev1.Pod) (app EiriniApp) {
 
 	json.Unmarshal([]byte(routesJSON), &routes)
 	app.Routes = routes
+
+	routeServices := map[string]string{}
+	json.Unmarshal([]byte(pod.GetAnnotations()[RouteServicesAnnotation]), &routeServices)
+	app.SetRouteServices(routeServices)
 	return
 }
 
+// SetRouteServices binds the route services (by hostname) to the routes which don't have one already
+func (e *EiriniApp) SetRouteServices(services map[string]string) {
+	for i, r := range e.Routes {
+		if url, ok := services[r.Hostname]; ok && r.RouteServiceURL == "" {
+			e.Routes[i].RouteServiceURL = url
+		}
+	}
+}
+
 // Validate returns true if we have enough information to handle routes
 func (e EiriniApp) Validate() bool {
-	return len(e.Routes) != 0 &&
-		e.GUID != "" &&
-		e.Name != "" &&
-		e.Namespace != "" &&
-		e.PodName != "" &&
-		e.InstanceID != ""
+	return len(e.invalidReasons()) == 0
+}
+
+// ValidationErrors returns the reasons why the routes of the app, or some of them, can't be handled.
+// Routes bound to a route service are reported too, as the generated Ingress leaves them out:
+// it would route straight to the app, skipping the route service.
+func (e EiriniApp) ValidationErrors() []string {
+	errs := e.invalidReasons()
+	for _, r := range e.Routes {
+		if r.RouteServiceURL != "" {
+			errs = append(errs, fmt.Sprintf("route %s is bound to the route service %s, which only the reverse proxy and gorouter enforce: it is left out of the Ingress", r.Hostname, r.RouteServiceURL))
+		}
+	}
+	return errs
+}
+
+// invalidReasons returns the reasons why none of the routes of the app can be handled
+func (e EiriniApp) invalidReasons() []string {
+	errs := []string{}
+	if len(e.Routes) == 0 {
+		errs = append(errs, fmt.Sprintf("no routes in the %s annotation", RoutesAnnotation))
+	}
+	if e.GUID == "" {
+		errs = append(errs, fmt.Sprintf("missing the %s label", eirinix.LabelGUID))
+	}
+	if e.Name == "" {
+		errs = append(errs, fmt.Sprintf("missing the %s annotation", AppNameAnnotation))
+	}
+	if e.Namespace == "" {
+		errs = append(errs, "missing the namespace")
+	}
+	if e.PodName == "" {
+		errs = append(errs, "missing the pod name")
+	}
+	if e.InstanceID == "" {
+		errs = append(errs, "missing the instance index in the pod name")
+	}
+	return errs
 }
 
 // FirstInstance returns true if the pod is the first instance (e.g. if scaled or not)
@@ -107,6 +168,28 @@ func (e EiriniApp) UpdateIngress(in *v1beta1.Ingress, labels, annotations map[st
 	return in
 }
 
+// resourceLabels returns the labels of the generated resources: the custom labels,
+// the kubernetes generic labels of the pod if enabled, and the ownership label
+func (e EiriniApp) resourceLabels(labels map[string]string) map[string]string {
+	// The custom labels are shared by all the apps, and never modified
+	res := map[string]string{}
+	for key, value := range labels {
+		res[key] = value
+	}
+
+	// Copy kubernetes generic labels from the pod
+	if e.CopyKubernetesGenericLabels == "true" {
+		for key, value := range e.Labels {
+			if strings.Contains(key, KubeGenericLabelPrefix) {
+				res[key] = value
+			}
+		}
+	}
+
+	res[ManagedByLabel] = ManagedBy
+	return res
+}
+
 // DesiredService generates the desired service from the routes annotated in the Eirini App
 func (e EiriniApp) DesiredService(labels, annotations map[string]string) *corev1.Service {
 	ports := []corev1.ServicePort{}
@@ -119,24 +202,11 @@ func (e EiriniApp) DesiredService(labels, annotations map[string]string) *corev1
 		addedPorts[route.Port] = nil
 	}
 
-	if labels == nil {
-		labels = map[string]string{}
-	}
-
-	// Copy kubernetes generic labels from pod to service
-	if e.CopyKubernetesGenericLabels == "true" {
-		for key, value := range e.Labels {
-			if strings.Contains(key, KubeGenericLabelPrefix) {
-				labels[key] = value
-			}
-		}
-	}
-
 	return &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        e.Name,
 			Namespace:   e.Namespace,
-			Labels:      labels,
+			Labels:      e.resourceLabels(labels),
 			Annotations: annotations,
 		},
 		Spec: corev1.ServiceSpec{
@@ -148,10 +218,58 @@ func (e EiriniApp) DesiredService(labels, annotations map[string]string) *corev1
 	}
 }
 
-// DesiredIngress generates the desired ingress from the routes annotated in the Eirini App
+// InstanceServiceName returns the name of the service of the app instance
+func (e EiriniApp) InstanceServiceName() string {
+	return fmt.Sprintf("%s-instance-%s", e.Name, e.InstanceID)
+}
+
+// DesiredInstanceService generates the desired service selecting only the pod of the app instance
+func (e EiriniApp) DesiredInstanceService(labels, annotations map[string]string) *corev1.Service {
+	// The labels are copied, as they are shared with the app service
+	svc := e.DesiredService(nil, annotations)
+	svc.Name = e.InstanceServiceName()
+	for k, v := range labels {
+		svc.Labels[k] = v
+	}
+	svc.Labels[InstanceServiceLabel] = e.Name
+	svc.Spec.Selector = map[string]string{PodNameLabel: e.PodName}
+	return svc
+}
+
+// AppTLSSecret returns the name of the per-app TLS secret
+func (e EiriniApp) AppTLSSecret() string {
+	return fmt.Sprintf("%s-tls", e.Name)
+}
+
+// SharedTLSSecret returns the shared TLS secret configured for the most specific domain
+// matching the hostname. It returns false if no domain matches.
+func (e EiriniApp) SharedTLSSecret(hostname string) (string, bool) {
+	secret := ""
+	best := -1
+	for domain, s := range e.TLSSecrets {
+		if score, ok := matchDomain(domain, hostname); ok && score > best {
+			secret, best = s, score
+		}
+	}
+	return secret, best >= 0
+}
+
+// ingressRoutes returns the routes which can be served by an Ingress, i.e. the ones not bound to a route service
+func (e EiriniApp) ingressRoutes() []Route {
+	routes := []Route{}
+	for _, r := range e.Routes {
+		if r.RouteServiceURL == "" {
+			routes = append(routes, r)
+		}
+	}
+	return routes
+}
+
+// DesiredIngress generates the desired ingress from the routes annotated in the Eirini App.
+// Routes bound to a route service are left out, and the ingress has no rules if all of them are.
 func (e EiriniApp) DesiredIngress(labels, annotations map[string]string, tls bool) *v1beta1.Ingress {
 	rules := []v1beta1.IngressRule{}
-	for _, route := range e.Routes {
+	for _, route := range e.ingressRoutes() {
 		rules = append(rules, v1beta1.IngressRule{
 			Host: route.Hostname,
 			IngressRuleValue: v1beta1.IngressRuleValue{
@@ -173,35 +291,40 @@ func (e EiriniApp) DesiredIngress(labels, annotations map[string]string, tls boo
 
 	if tls {
 		tlsEntry := []v1beta1.IngressTLS{}
-		for _, route := range e.Routes {
+		shared := map[string]int{}
+		for _, route := range e.ingressRoutes() {
+			secret, ok := e.SharedTLSSecret(route.Hostname)
+			if !ok {
+				tlsEntry = append(tlsEntry,
+					v1beta1.IngressTLS{
+						Hosts:      []string{route.Hostname},
+						SecretName: e.AppTLSSecret(),
+					})
+				continue
+			}
 
+			// Group all the hosts covered by the same shared secret in one entry
+			if i, ok := shared[secret]; ok {
+				if !containsString(tlsEntry[i].Hosts, route.Hostname) {
+					tlsEntry[i].Hosts = append(tlsEntry[i].Hosts, route.Hostname)
+				}
+				continue
+			}
+			shared[secret] = len(tlsEntry)
 			tlsEntry = append(tlsEntry,
 				v1beta1.IngressTLS{
 					Hosts:      []string{route.Hostname},
-					SecretName: fmt.Sprintf("%s-tls", e.DesiredService(labels, annotations).ObjectMeta.Name),
+					SecretName: secret,
 				})
 		}
 		spec.TLS = tlsEntry
 	}
 
-	if labels == nil {
-		labels = map[string]string{}
-	}
-
-	// Copy kubernetes generic labels from pod to ingress
-	if e.CopyKubernetesGenericLabels == "true" {
-		for key, value := range e.Labels {
-			if strings.Contains(key, KubeGenericLabelPrefix) {
-				labels[key] = value
-			}
-		}
-	}
-
 	return &v1beta1.Ingress{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        e.Name,
 			Namespace:   e.Namespace,
-			Labels:      labels,
+			Labels:      e.resourceLabels(labels),
 			Annotations: annotations,
 		},
 		Spec: spec,
@@ -56,6 +56,19 @@ var _ = Describe("Route Handler", func() {
 			})
 		})
 
+		Context("invalid Eirini App", func() {
+			It("explains what is missing", func() {
+				invalid := NewEiriniApp(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "bar"}})
+				Expect(invalid.Validate()).To(BeFalse())
+				Expect(invalid.ValidationErrors()).To(Equal([]string{
+					"no routes in the cloudfoundry.org/routes annotation",
+					"missing the cloudfoundry.org/guid label",
+					"missing the cloudfoundry.org/application_name annotation",
+				}))
+				Expect(app.ValidationErrors()).To(BeEmpty())
+			})
+		})
+
 		Context("App updates", func() {
 			var app2 EiriniApp
 			BeforeEach(func() {
@@ -103,7 +116,7 @@ var _ = Describe("Route Handler", func() {
 
 		Context("Custom Annotations and Labels", func() {
 			var app2 EiriniApp
-			var testLabel, testAnnotations map[string]string
+			var testLabel, testAnnotations, expectedLabels map[string]string
 			BeforeEach(func() {
 				app2 = NewEiriniApp(&corev1.Pod{
 					ObjectMeta: metav1.ObjectMeta{
@@ -118,6 +131,8 @@ var _ = Describe("Route Handler", func() {
 					}})
 				testLabel = map[string]string{"foo": "bar"}
 				testAnnotations = map[string]string{"baz": "annotation"}
+				// The generic labels of the pod are copied, and the ownership label added
+				expectedLabels = map[string]string{"foo": "bar", "app.kubernetes.io/name": "foo", ManagedByLabel: ManagedBy}
 			})
 
 			It("adds annotations and labels correctly", func() {
@@ -125,9 +140,11 @@ var _ = Describe("Route Handler", func() {
 				currentingr := app.DesiredIngress(testLabel, testAnnotations, true)
 
 				Expect(currentsvc.Annotations).Should(Equal(testAnnotations))
-				Expect(currentsvc.Labels).Should(Equal(testLabel))
+				Expect(currentsvc.Labels).Should(Equal(expectedLabels))
 				Expect(currentingr.Annotations).Should(Equal(testAnnotations))
-				Expect(currentingr.Labels).Should(Equal(testLabel))
+				Expect(currentingr.Labels).Should(Equal(expectedLabels))
+				// The generic labels of one app don't leak into the resources of the others
+				Expect(testLabel).Should(Equal(map[string]string{"foo": "bar"}))
 			})
 
 			It("updates annotations and labels correctly", func() {
@@ -136,9 +153,127 @@ var _ = Describe("Route Handler", func() {
 				app2.UpdateService(currentsvc, testLabel, testAnnotations)
 				app2.UpdateIngress(currentingr, testLabel, testAnnotations, true)
 				Expect(currentsvc.Annotations).Should(Equal(testAnnotations))
-				Expect(currentsvc.Labels).Should(Equal(testLabel))
+				Expect(currentsvc.Labels).Should(Equal(expectedLabels))
 				Expect(currentingr.Annotations).Should(Equal(testAnnotations))
-				Expect(currentingr.Labels).Should(Equal(testLabel))
+				Expect(currentingr.Labels).Should(Equal(expectedLabels))
+				// The generic labels of one app don't leak into the resources of the others
+				Expect(testLabel).Should(Equal(map[string]string{"foo": "bar"}))
+			})
+		})
+
+		Context("Shared TLS secrets", func() {
+			var app2 EiriniApp
+			BeforeEach(func() {
+				app2 = NewEiriniApp(&corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "foo",
+						Name:      "dizzylizard-test-79699025f0-0",
+						Labels: map[string]string{
+							eirinix.LabelGUID: "test2",
+						},
+						Annotations: map[string]string{
+							AppNameAnnotation: "foo",
+							RoutesAnnotation: `[{"hostname":"foo.apps.example.com","port":8080},
+							                    {"hostname":"bar.apps.example.com","port":8080},
+							                    {"hostname":"foo.eu.apps.example.com","port":8080},
+							                    {"hostname":"foo.other.com","port":8080}]`,
+						},
+					}})
+				app2.TLSSecrets = map[string]string{
+					"*.apps.example.com":    "wildcard-apps-tls",
+					"*.eu.apps.example.com": "wildcard-eu-tls",
+					"bar.apps.example.com":  "bar-tls",
+				}
+			})
+
+			It("picks the most specific domain", func() {
+				secret, ok := app2.SharedTLSSecret("foo.apps.example.com")
+				Expect(ok).To(BeTrue())
+				Expect(secret).To(Equal("wildcard-apps-tls"))
+
+				secret, ok = app2.SharedTLSSecret("foo.eu.apps.example.com")
+				Expect(ok).To(BeTrue())
+				Expect(secret).To(Equal("wildcard-eu-tls"))
+
+				secret, ok = app2.SharedTLSSecret("bar.apps.example.com")
+				Expect(ok).To(BeTrue())
+				Expect(secret).To(Equal("bar-tls"))
+
+				_, ok = app2.SharedTLSSecret("apps.example.com")
+				Expect(ok).To(BeFalse())
+				_, ok = app2.SharedTLSSecret("foo.us.apps.example.com")
+				Expect(ok).To(BeFalse())
+				_, ok = app2.SharedTLSSecret("foo.other.com")
+				Expect(ok).To(BeFalse())
+			})
+
+			It("groups TLS entries per secret", func() {
+				app2.Routes = append(app2.Routes, Route{Hostname: "baz.apps.example.com", Port: 9090})
+				ingr := app2.DesiredIngress(nil, nil, true)
+				Expect(len(ingr.Spec.TLS)).To(Equal(4))
+				Expect(ingr.Spec.TLS[0].SecretName).To(Equal("wildcard-apps-tls"))
+				Expect(ingr.Spec.TLS[0].Hosts).To(Equal([]string{"foo.apps.example.com", "baz.apps.example.com"}))
+				Expect(ingr.Spec.TLS[1].SecretName).To(Equal("bar-tls"))
+				Expect(ingr.Spec.TLS[1].Hosts).To(Equal([]string{"bar.apps.example.com"}))
+				Expect(ingr.Spec.TLS[2].SecretName).To(Equal("wildcard-eu-tls"))
+				Expect(ingr.Spec.TLS[2].Hosts).To(Equal([]string{"foo.eu.apps.example.com"}))
+				Expect(ingr.Spec.TLS[3].SecretName).To(Equal("foo-tls"))
+				Expect(ingr.Spec.TLS[3].Hosts).To(Equal([]string{"foo.other.com"}))
+			})
+		})
+
+		Context("Route services", func() {
+			It("reads the route service URLs from the routes and the annotation", func() {
+				app2 := NewEiriniApp(&corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "foo",
+						Name:      "dizzylizard-test-79699025f0-0",
+						Labels: map[string]string{
+							eirinix.LabelGUID: "test2",
+						},
+						Annotations: map[string]string{
+							AppNameAnnotation: "foo",
+							RoutesAnnotation: `[{"hostname":"foo.example.com","port":8080,"route_service_url":"https://rs.example.com"},
+							                    {"hostname":"bar.example.com","port":8080},
+							                    {"hostname":"baz.example.com","port":8080}]`,
+							RouteServicesAnnotation: `{"foo.example.com":"https://ignored.example.com","bar.example.com":"https://bar-rs.example.com"}`,
+						},
+					}})
+				app2.SetRouteServices(map[string]string{"bar.example.com": "https://ignored.example.com", "baz.example.com": "https://baz-rs.example.com"})
+				Expect(app2.Routes).To(Equal([]Route{
+					{Hostname: "foo.example.com", Port: 8080, RouteServiceURL: "https://rs.example.com"},
+					{Hostname: "bar.example.com", Port: 8080, RouteServiceURL: "https://bar-rs.example.com"},
+					{Hostname: "baz.example.com", Port: 8080, RouteServiceURL: "https://baz-rs.example.com"},
+				}))
+			})
+
+			It("leaves the routes bound to a route service out of the ingress", func() {
+				app2 := NewEiriniApp(&corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "foo",
+						Name:      "dizzylizard-test-79699025f0-0",
+						Labels: map[string]string{
+							eirinix.LabelGUID: "test2",
+						},
+						Annotations: map[string]string{
+							AppNameAnnotation: "foo",
+							RoutesAnnotation: `[{"hostname":"foo.example.com","port":8080,"route_service_url":"https://rs.example.com"},
+							                    {"hostname":"bar.example.com","port":8080}]`,
+						},
+					}})
+				Expect(app2.Validate()).To(BeTrue())
+				Expect(app2.ValidationErrors()).To(Equal([]string{
+					"route foo.example.com is bound to the route service https://rs.example.com, which only the reverse proxy and gorouter enforce: it is left out of the Ingress",
+				}))
+
+				ingr := app2.DesiredIngress(nil, nil, true)
+				Expect(ingr.Spec.Rules).To(HaveLen(1))
+				Expect(ingr.Spec.Rules[0].Host).To(Equal("bar.example.com"))
+				Expect(ingr.Spec.TLS).To(HaveLen(1))
+				Expect(ingr.Spec.TLS[0].Hosts).To(Equal([]string{"bar.example.com"}))
+
+				app2.Routes = app2.Routes[:1]
+				Expect(app2.DesiredIngress(nil, nil, true).Spec.Rules).To(BeEmpty())
 			})
 		})
 	})
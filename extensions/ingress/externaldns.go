@@ -0,0 +1,237 @@
+package ingress
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	eirinix "github.com/SUSE/eirinix"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// ExternalDNSAnnotations publishes the hostnames with annotations on the generated ingresses
+	ExternalDNSAnnotations = "annotations"
+	// ExternalDNSEndpoints publishes the hostnames with DNSEndpoint resources
+	ExternalDNSEndpoints = "crd"
+
+	// ExternalDNSHostnameAnnotation is the ExternalDNS annotation listing the hostnames to publish
+	ExternalDNSHostnameAnnotation = "external-dns.alpha.kubernetes.io/hostname"
+	// ExternalDNSTargetAnnotation is the ExternalDNS annotation listing the record targets
+	ExternalDNSTargetAnnotation = "external-dns.alpha.kubernetes.io/target"
+	// ExternalDNSTTLAnnotation is the ExternalDNS annotation containing the record TTL
+	ExternalDNSTTLAnnotation = "external-dns.alpha.kubernetes.io/ttl"
+
+	// DNSEndpointLabel is the label set on the DNSEndpoints generated by the extension
+	DNSEndpointLabel = "eirinix.suse.org/ingress-dns"
+)
+
+// DNSEndpointResource is the ExternalDNS DNSEndpoint custom resource
+var DNSEndpointResource = schema.GroupVersionResource{Group: "externaldns.k8s.io", Version: "v1alpha1", Resource: "dnsendpoints"}
+
+// ExternalDNS publishes the route hostnames of the apps through ExternalDNS.
+// In annotations mode the generated ingresses are annotated, in crd mode a DNSEndpoint
+// is kept for each ingress.
+type ExternalDNS struct {
+	Mode string
+	// Targets are the record targets. If empty, the ingress load balancer addresses are used
+	Targets []string
+	// TTL of the records in seconds, the ExternalDNS default is used if 0
+	TTL int64
+}
+
+// NewExternalDNS returns an ExternalDNS in the given mode
+func NewExternalDNS(mode string, targets []string, ttl int64) *ExternalDNS {
+	return &ExternalDNS{Mode: mode, Targets: targets, TTL: ttl}
+}
+
+// Annotate adds the ExternalDNS annotations to the ingress in annotations mode
+func (d *ExternalDNS) Annotate(in *v1beta1.Ingress) {
+	if d.Mode != ExternalDNSAnnotations {
+		return
+	}
+
+	// Annotations might be shared with other resources
+	annotations := map[string]string{}
+	for k, v := range in.Annotations {
+		annotations[k] = v
+	}
+	annotations[ExternalDNSHostnameAnnotation] = strings.Join(ingressHosts(in), ",")
+	if len(d.Targets) != 0 {
+		annotations[ExternalDNSTargetAnnotation] = strings.Join(d.Targets, ",")
+	}
+	if d.TTL != 0 {
+		annotations[ExternalDNSTTLAnnotation] = strconv.FormatInt(d.TTL, 10)
+	}
+	in.Annotations = annotations
+}
+
+// DesiredEndpoint returns the DNSEndpoint of the ingress. It has no endpoints until
+// the targets are known.
+func (d *ExternalDNS) DesiredEndpoint(in *v1beta1.Ingress) *unstructured.Unstructured {
+	targets := d.Targets
+	if len(targets) == 0 {
+		targets = loadBalancerAddresses(in)
+	}
+	ips, names := []interface{}{}, []interface{}{}
+	for _, t := range targets {
+		if net.ParseIP(t) != nil {
+			ips = append(ips, t)
+		} else {
+			names = append(names, t)
+		}
+	}
+
+	endpoints := []interface{}{}
+	for _, host := range ingressHosts(in) {
+		for _, record := range []struct {
+			recordType string
+			targets    []interface{}
+		}{{"A", ips}, {"CNAME", names}} {
+			if len(record.targets) == 0 {
+				continue
+			}
+			endpoint := map[string]interface{}{
+				"dnsName":    host,
+				"recordType": record.recordType,
+				"targets":    record.targets,
+			}
+			if d.TTL != 0 {
+				endpoint["recordTTL"] = d.TTL
+			}
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{"endpoints": endpoints},
+	}}
+	obj.SetAPIVersion("externaldns.k8s.io/v1alpha1")
+	obj.SetKind("DNSEndpoint")
+	obj.SetName(in.GetName())
+	obj.SetNamespace(in.GetNamespace())
+	obj.SetLabels(map[string]string{DNSEndpointLabel: "true"})
+	return obj
+}
+
+// EnsureEndpoint creates or updates the DNSEndpoint of the ingress in crd mode. The ingress must be
+// the one in the cluster, as its load balancer addresses are the targets if none are configured.
+// Existing records are kept while no targets are known.
+func (d *ExternalDNS) EnsureEndpoint(client dynamic.Interface, in *v1beta1.Ingress) error {
+	if d.Mode != ExternalDNSEndpoints {
+		return nil
+	}
+	desired := d.DesiredEndpoint(in)
+	known := len(d.Targets) != 0 || len(loadBalancerAddresses(in)) != 0
+
+	res := client.Resource(DNSEndpointResource).Namespace(in.GetNamespace())
+	current, err := res.Get(in.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = res.Create(desired, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if !known {
+		return nil
+	}
+	current.Object["spec"] = desired.Object["spec"]
+	_, err = res.Update(current, metav1.UpdateOptions{})
+	return err
+}
+
+// DeleteEndpoint removes the DNSEndpoint of the ingress in crd mode
+func (d *ExternalDNS) DeleteEndpoint(client dynamic.Interface, namespace, name string) error {
+	if d.Mode != ExternalDNSEndpoints {
+		return nil
+	}
+	err := client.Resource(DNSEndpointResource).Namespace(namespace).Delete(name, &metav1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// Sync refreshes the DNSEndpoints of the namespace with the ingress addresses, and removes
+// the ones whose ingress is gone
+func (d *ExternalDNS) Sync(client kubernetes.Interface, dyn dynamic.Interface, namespace string) error {
+	if d.Mode != ExternalDNSEndpoints {
+		return nil
+	}
+
+	set := labels.Set{DNSEndpointLabel: "true"}
+	endpoints, err := dyn.Resource(DNSEndpointResource).Namespace(namespace).List(metav1.ListOptions{LabelSelector: set.AsSelector().String()})
+	if err != nil {
+		return err
+	}
+	for _, e := range endpoints.Items {
+		in, err := client.ExtensionsV1beta1().Ingresses(namespace).Get(e.GetName(), metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			err = d.DeleteEndpoint(dyn, namespace, e.GetName())
+		case err == nil:
+			// Ingresses get their address after being created
+			err = d.EnsureEndpoint(dyn, in)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run periodically syncs the DNSEndpoints of the namespace until stop is closed
+func (d *ExternalDNS) Run(manager eirinix.Manager, namespace string, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		clientset, err := getClientSet(manager)
+		if err == nil {
+			var dyn dynamic.Interface
+			dyn, err = getDynamicClient(manager)
+			if err == nil {
+				err = d.Sync(clientset, dyn, namespace)
+			}
+		}
+		if err != nil {
+			manager.GetLogger().Error("Failed syncing DNS endpoints: ", err.Error())
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func ingressHosts(in *v1beta1.Ingress) []string {
+	hosts := []string{}
+	for _, r := range in.Spec.Rules {
+		if r.Host != "" && !containsString(hosts, r.Host) {
+			hosts = append(hosts, r.Host)
+		}
+	}
+	return hosts
+}
+
+func loadBalancerAddresses(in *v1beta1.Ingress) []string {
+	addresses := []string{}
+	for _, lb := range in.Status.LoadBalancer.Ingress {
+		if lb.IP != "" {
+			addresses = append(addresses, lb.IP)
+		} else if lb.Hostname != "" {
+			addresses = append(addresses, lb.Hostname)
+		}
+	}
+	return addresses
+}
@@ -0,0 +1,133 @@
+package ingress_test
+
+import (
+	. "github.com/mudler/eirini-ingress/extensions/ingress"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("ExternalDNS", func() {
+	var in *v1beta1.Ingress
+
+	endpoints := func(obj *unstructured.Unstructured) []interface{} {
+		endpoints, _, err := unstructured.NestedSlice(obj.Object, "spec", "endpoints")
+		Expect(err).ToNot(HaveOccurred())
+		return endpoints
+	}
+
+	BeforeEach(func() {
+		in = &v1beta1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "foo",
+				Namespace:   "eirini",
+				Annotations: map[string]string{"custom": "annotation"},
+			},
+			Spec: v1beta1.IngressSpec{
+				Rules: []v1beta1.IngressRule{
+					{Host: "foo.example.com"},
+					{Host: "bar.example.com"},
+					{Host: "foo.example.com"},
+				},
+			},
+		}
+	})
+
+	Context("in annotations mode", func() {
+		It("annotates the ingress with its hostnames", func() {
+			shared := in.Annotations
+			NewExternalDNS(ExternalDNSAnnotations, []string{"10.0.0.1", "lb.example.com"}, 60).Annotate(in)
+
+			Expect(in.Annotations).To(Equal(map[string]string{
+				"custom":                      "annotation",
+				ExternalDNSHostnameAnnotation: "foo.example.com,bar.example.com",
+				ExternalDNSTargetAnnotation:   "10.0.0.1,lb.example.com",
+				ExternalDNSTTLAnnotation:      "60",
+			}))
+			Expect(shared).To(Equal(map[string]string{"custom": "annotation"}))
+		})
+
+		It("leaves the targets and the TTL to ExternalDNS if not set", func() {
+			NewExternalDNS(ExternalDNSAnnotations, nil, 0).Annotate(in)
+			Expect(in.Annotations).To(HaveKey(ExternalDNSHostnameAnnotation))
+			Expect(in.Annotations).ToNot(HaveKey(ExternalDNSTargetAnnotation))
+			Expect(in.Annotations).ToNot(HaveKey(ExternalDNSTTLAnnotation))
+		})
+
+		It("doesn't annotate in crd mode", func() {
+			NewExternalDNS(ExternalDNSEndpoints, nil, 0).Annotate(in)
+			Expect(in.Annotations).To(Equal(map[string]string{"custom": "annotation"}))
+		})
+	})
+
+	Context("in crd mode", func() {
+		It("generates the records for the configured targets", func() {
+			endpoint := NewExternalDNS(ExternalDNSEndpoints, []string{"10.0.0.1", "lb.example.com"}, 60).DesiredEndpoint(in)
+			Expect(endpoint.GetName()).To(Equal("foo"))
+			Expect(endpoint.GetNamespace()).To(Equal("eirini"))
+			Expect(endpoint.GetLabels()).To(HaveKeyWithValue(DNSEndpointLabel, "true"))
+			Expect(endpoints(endpoint)).To(Equal([]interface{}{
+				map[string]interface{}{"dnsName": "foo.example.com", "recordType": "A", "targets": []interface{}{"10.0.0.1"}, "recordTTL": int64(60)},
+				map[string]interface{}{"dnsName": "foo.example.com", "recordType": "CNAME", "targets": []interface{}{"lb.example.com"}, "recordTTL": int64(60)},
+				map[string]interface{}{"dnsName": "bar.example.com", "recordType": "A", "targets": []interface{}{"10.0.0.1"}, "recordTTL": int64(60)},
+				map[string]interface{}{"dnsName": "bar.example.com", "recordType": "CNAME", "targets": []interface{}{"lb.example.com"}, "recordTTL": int64(60)},
+			}))
+		})
+
+		It("targets the load balancer of the ingress if no targets are configured", func() {
+			d := NewExternalDNS(ExternalDNSEndpoints, nil, 0)
+			Expect(endpoints(d.DesiredEndpoint(in))).To(BeEmpty())
+
+			in.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "10.0.0.2"}}
+			Expect(endpoints(d.DesiredEndpoint(in))).To(Equal([]interface{}{
+				map[string]interface{}{"dnsName": "foo.example.com", "recordType": "A", "targets": []interface{}{"10.0.0.2"}},
+				map[string]interface{}{"dnsName": "bar.example.com", "recordType": "A", "targets": []interface{}{"10.0.0.2"}},
+			}))
+		})
+
+		It("keeps the records while the load balancer address is unknown", func() {
+			d := NewExternalDNS(ExternalDNSEndpoints, nil, 0)
+			dyn := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+
+			in.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "10.0.0.2"}}
+			Expect(d.EnsureEndpoint(dyn, in)).To(Succeed())
+
+			in.Status.LoadBalancer.Ingress = nil
+			Expect(d.EnsureEndpoint(dyn, in)).To(Succeed())
+			endpoint, err := dyn.Resource(DNSEndpointResource).Namespace("eirini").Get("foo", metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(endpoints(endpoint)).To(HaveLen(2))
+		})
+
+		It("syncs the endpoints with the ingresses", func() {
+			d := NewExternalDNS(ExternalDNSEndpoints, nil, 0)
+			dyn := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+			Expect(d.EnsureEndpoint(dyn, in)).To(Succeed())
+			gone := in.DeepCopy()
+			gone.Name = "gone"
+			Expect(d.EnsureEndpoint(dyn, gone)).To(Succeed())
+
+			// The ingress gets its address after the endpoint was created
+			in.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{Hostname: "lb.example.com"}}
+			client := fake.NewSimpleClientset(in)
+			Expect(d.Sync(client, dyn, "eirini")).To(Succeed())
+
+			endpoint, err := dyn.Resource(DNSEndpointResource).Namespace("eirini").Get("foo", metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(endpoints(endpoint)).To(Equal([]interface{}{
+				map[string]interface{}{"dnsName": "foo.example.com", "recordType": "CNAME", "targets": []interface{}{"lb.example.com"}},
+				map[string]interface{}{"dnsName": "bar.example.com", "recordType": "CNAME", "targets": []interface{}{"lb.example.com"}},
+			}))
+
+			_, err = dyn.Resource(DNSEndpointResource).Namespace("eirini").Get("gone", metav1.GetOptions{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,175 @@
+package ingress
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	eirinix "github.com/SUSE/eirinix"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DefaultAppPort is the port of the imported routes for apps without routes nor container ports,
+// as in Cloud Foundry
+const DefaultAppPort = 8080
+
+// GorouterRoute is a route of a gorouter routing table
+type GorouterRoute struct {
+	// URI is the hostname, with the context path if any
+	URI             string `json:"uri"`
+	AppGUID         string `json:"app_guid"`
+	RouteServiceURL string `json:"route_service_url,omitempty"`
+}
+
+// UnmatchedRoute is a route which couldn't be imported, with the reason
+type UnmatchedRoute struct {
+	GorouterRoute
+	Reason string `json:"reason"`
+}
+
+// gorouterEndpoint is an endpoint of the gorouter `/routes` dump, by URI
+type gorouterEndpoint struct {
+	Address         string            `json:"address"`
+	RouteServiceURL string            `json:"route_service_url"`
+	Tags            map[string]string `json:"tags"`
+}
+
+// routingAPIRoute is a route of the routing API `/routing/v1/routes` response
+type routingAPIRoute struct {
+	Route           string `json:"route"`
+	LogGUID         string `json:"log_guid"`
+	RouteServiceURL string `json:"route_service_url"`
+}
+
+// ParseGorouterRoutes reads the routes of a gorouter `/routes` dump, or of a routing API
+// `/routing/v1/routes` response. Routes are deduplicated by URI and app, and sorted.
+func ParseGorouterRoutes(data []byte) ([]GorouterRoute, error) {
+	routes := []GorouterRoute{}
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(data, []byte("{")):
+		dump := map[string][]gorouterEndpoint{}
+		if err := json.Unmarshal(data, &dump); err != nil {
+			return nil, fmt.Errorf("invalid gorouter routes: %s", err.Error())
+		}
+		for uri, endpoints := range dump {
+			for _, e := range endpoints {
+				routes = append(routes, GorouterRoute{URI: uri, AppGUID: e.Tags["app_id"], RouteServiceURL: e.RouteServiceURL})
+			}
+		}
+	case bytes.HasPrefix(data, []byte("[")):
+		list := []routingAPIRoute{}
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, fmt.Errorf("invalid routing API routes: %s", err.Error())
+		}
+		for _, r := range list {
+			routes = append(routes, GorouterRoute{URI: r.Route, AppGUID: r.LogGUID, RouteServiceURL: r.RouteServiceURL})
+		}
+	default:
+		return nil, fmt.Errorf("unknown routes format, expected a gorouter /routes dump or a routing API route list")
+	}
+
+	unique := []GorouterRoute{}
+	seen := map[GorouterRoute]interface{}{}
+	for _, r := range routes {
+		r.URI = strings.ToLower(r.URI)
+		if _, ok := seen[r]; !ok {
+			seen[r] = nil
+			unique = append(unique, r)
+		}
+	}
+	sort.Slice(unique, func(i, j int) bool {
+		if unique[i].URI != unique[j].URI {
+			return unique[i].URI < unique[j].URI
+		}
+		return unique[i].AppGUID < unique[j].AppGUID
+	})
+	return unique, nil
+}
+
+// appPort returns the port of the routes imported for the app
+func appPort(app EiriniApp, pod *corev1.Pod) int {
+	if len(app.Routes) != 0 {
+		return app.Routes[0].Port
+	}
+	for _, c := range pod.Spec.Containers {
+		for _, p := range c.Ports {
+			return int(p.ContainerPort)
+		}
+	}
+	return DefaultAppPort
+}
+
+// ImportGorouterRoutes matches the routes to the Eirini apps of the pods by app GUID, and returns
+// the Services and Ingresses generated for the apps with their imported routes added, as the watcher
+// would generate them. Routes which
+// can't be matched are returned with the reason.
+func (pw *PodWatcher) ImportGorouterRoutes(pods []corev1.Pod, routes []GorouterRoute) ([]runtime.Object, []UnmatchedRoute) {
+	type appPod struct {
+		app EiriniApp
+		pod *corev1.Pod
+	}
+	apps := map[string]*appPod{}
+	for i := range pods {
+		guid := pods[i].GetLabels()[eirinix.LabelGUID]
+		if _, ok := apps[guid]; guid == "" || ok {
+			continue
+		}
+		app := NewEiriniApp(&pods[i])
+		app.TLSSecrets = pw.TLSSecrets
+		apps[guid] = &appPod{app: app, pod: &pods[i]}
+	}
+
+	unmatched := []UnmatchedRoute{}
+	matched := map[string]interface{}{}
+	for _, r := range routes {
+		hostname, path := r.URI, ""
+		if i := strings.Index(r.URI, "/"); i != -1 {
+			hostname, path = r.URI[:i], r.URI[i:]
+		}
+		a, ok := apps[r.AppGUID]
+		switch {
+		case r.AppGUID == "":
+			unmatched = append(unmatched, UnmatchedRoute{GorouterRoute: r, Reason: "no app GUID in the route"})
+			continue
+		case !ok:
+			unmatched = append(unmatched, UnmatchedRoute{GorouterRoute: r, Reason: fmt.Sprintf("no Eirini app with GUID %s", r.AppGUID)})
+			continue
+		case path != "" && path != "/":
+			unmatched = append(unmatched, UnmatchedRoute{GorouterRoute: r, Reason: "context path routes are not supported"})
+			continue
+		}
+
+		matched[r.AppGUID] = nil
+		exists := false
+		for _, route := range a.app.Routes {
+			if strings.EqualFold(route.Hostname, hostname) {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			a.app.Routes = append(a.app.Routes, Route{Hostname: hostname, Port: appPort(a.app, a.pod), RouteServiceURL: r.RouteServiceURL})
+		}
+	}
+
+	guids := []string{}
+	for guid := range matched {
+		guids = append(guids, guid)
+	}
+	sort.Strings(guids)
+	objects := []runtime.Object{}
+	for _, guid := range guids {
+		app := apps[guid].app
+		app.SetRouteServices(pw.RouteServices)
+		objects = append(objects, pw.DesiredService(app))
+		// Apps whose routes are all bound to route services have no ingress
+		if in := pw.DesiredIngress(app); len(in.Spec.Rules) != 0 {
+			objects = append(objects, in)
+		}
+	}
+	return objects, unmatched
+}
@@ -0,0 +1,80 @@
+package ingress_test
+
+import (
+	. "github.com/mudler/eirini-ingress/extensions/ingress"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+var _ = Describe("Gorouter import", func() {
+	It("parses the gorouter /routes dump", func() {
+		routes, err := ParseGorouterRoutes([]byte(`{
+			"Foo.example.com": [
+				{"address": "10.0.16.5:61001", "tags": {"app_id": "foo-guid", "component": "route-emitter"}},
+				{"address": "10.0.16.6:61001", "tags": {"app_id": "foo-guid", "component": "route-emitter"}}
+			],
+			"auth.example.com": [
+				{"address": "10.0.16.7:61002", "route_service_url": "https://rs.example.com", "tags": {"app_id": "bar-guid"}}
+			]
+		}`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(routes).To(Equal([]GorouterRoute{
+			{URI: "auth.example.com", AppGUID: "bar-guid", RouteServiceURL: "https://rs.example.com"},
+			{URI: "foo.example.com", AppGUID: "foo-guid"},
+		}))
+	})
+
+	It("parses the routing API routes", func() {
+		routes, err := ParseGorouterRoutes([]byte(`[
+			{"route": "foo.example.com", "port": 61001, "ip": "10.0.16.5", "log_guid": "foo-guid"},
+			{"route": "foo.example.com/api", "port": 61001, "ip": "10.0.16.5", "log_guid": "foo-guid"}
+		]`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(routes).To(Equal([]GorouterRoute{
+			{URI: "foo.example.com", AppGUID: "foo-guid"},
+			{URI: "foo.example.com/api", AppGUID: "foo-guid"},
+		}))
+
+		_, err = ParseGorouterRoutes([]byte(`routes`))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("generates the resources of the matched apps", func() {
+		pw := NewPodWatcher(nil, nil)
+		foo := appPod("foo", "foo-guid", "0", `[{"hostname":"foo.example.com","port":9000}]`)
+		bar := appPod("bar", "bar-guid", "0", "")
+		bar.Spec.Containers = []corev1.Container{{Ports: []corev1.ContainerPort{{ContainerPort: 8081}}}}
+
+		objects, unmatched := pw.ImportGorouterRoutes([]corev1.Pod{*foo, *bar}, []GorouterRoute{
+			{URI: "auth.example.com", AppGUID: "bar-guid", RouteServiceURL: "https://rs.example.com"},
+			{URI: "foo.example.com", AppGUID: "foo-guid"},
+			{URI: "foo.example.com/api", AppGUID: "foo-guid"},
+			{URI: "old.example.com", AppGUID: "foo-guid"},
+			{URI: "gone.example.com", AppGUID: "gone-guid"},
+			{URI: "tcp.example.com"},
+		})
+		Expect(unmatched).To(Equal([]UnmatchedRoute{
+			{GorouterRoute: GorouterRoute{URI: "foo.example.com/api", AppGUID: "foo-guid"}, Reason: "context path routes are not supported"},
+			{GorouterRoute: GorouterRoute{URI: "gone.example.com", AppGUID: "gone-guid"}, Reason: "no Eirini app with GUID gone-guid"},
+			{GorouterRoute: GorouterRoute{URI: "tcp.example.com"}, Reason: "no app GUID in the route"},
+		}))
+
+		// bar has no ingress, as its only route is bound to a route service
+		Expect(objects).To(HaveLen(3))
+		barService := objects[0].(*corev1.Service)
+		Expect(barService.GetName()).To(Equal("bar"))
+		Expect(barService.Spec.Ports[0].Port).To(Equal(int32(8081)))
+		Expect(objects[1].(*corev1.Service).GetName()).To(Equal("foo"))
+
+		fooIngress := objects[2].(*v1beta1.Ingress)
+		Expect(fooIngress.GetName()).To(Equal("foo"))
+		hosts := []string{}
+		for _, r := range fooIngress.Spec.Rules {
+			hosts = append(hosts, r.Host)
+			Expect(r.HTTP.Paths[0].Backend.ServicePort.IntValue()).To(Equal(9000))
+		}
+		Expect(hosts).To(Equal([]string{"foo.example.com", "old.example.com"}))
+	})
+})
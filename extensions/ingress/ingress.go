@@ -2,29 +2,58 @@ package ingress
 
 import (
 	"fmt"
+	"strings"
 
 	eirinix "github.com/SUSE/eirinix"
 	corev1 "k8s.io/api/core/v1"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
 )
 
 type PodWatcher struct {
 	GetRouteHandler                 func(*corev1.Pod) RouteHandler
 	CustomLabels, CustomAnnotations map[string]string
 	TLS                             bool
+	// TLSSecrets maps domains to shared TLS secrets, see EiriniApp.TLSSecrets
+	TLSSecrets map[string]string
+	// RouteServices binds route services to the route hostnames, unless the pod sets its own
+	RouteServices map[string]string
+	// CA issues the certificates of the per-app TLS secrets, when set
+	CA *SelfSignedCA
+	// Monitor checks the certificates of the referenced TLS secrets, when set
+	Monitor *CertificateMonitor
+	// Replicator copies the referenced TLS secrets from their central namespace, when set
+	Replicator *SecretReplicator
+	// ExternalDNS publishes the route hostnames through ExternalDNS, when set
+	ExternalDNS *ExternalDNS
+	// Routes is kept up to date with the routes of the apps, when set
+	Routes *RouteTable
+	// InstanceServices enables a service for each app instance, selecting only its pod
+	InstanceServices bool
+	// AdoptUnlabeled recognizes the Services and Ingresses generated before the ownership label,
+	// which are otherwise left alone
+	AdoptUnlabeled bool
 }
 
 func NewPodWatcher(labels, annotations map[string]string) *PodWatcher {
-	return &PodWatcher{
-		GetRouteHandler: func(pod *corev1.Pod) RouteHandler {
-			return NewEiriniApp(pod)
-		},
+	pw := &PodWatcher{
 		CustomLabels:      labels,
 		CustomAnnotations: annotations,
 	}
+	pw.GetRouteHandler = func(pod *corev1.Pod) RouteHandler {
+		app := NewEiriniApp(pod)
+		app.TLSSecrets = pw.TLSSecrets
+		app.SetRouteServices(pw.RouteServices)
+		return app
+	}
+	return pw
 }
 
 func (pw *PodWatcher) Handle(manager eirinix.Manager, e watch.Event) {
@@ -48,14 +77,36 @@ func (pw *PodWatcher) Handle(manager eirinix.Manager, e watch.Event) {
 
 	app := pw.GetRouteHandler(pod)
 	if !app.Validate() {
+		// A pod which is no longer a valid app doesn't keep its routes
+		if pw.Routes != nil && e.Type != watch.Added {
+			pw.Routes.DeletePod(pod)
+		}
 		fmt.Println("Missing app data", app)
 		return
 	}
+	if eiriniApp, ok := app.(EiriniApp); ok && e.Type == watch.Added {
+		for _, err := range eiriniApp.ValidationErrors() {
+			manager.GetLogger().Warn("Pod ", pod.GetName(), ": ", err)
+		}
+	}
+
+	if pw.Routes != nil {
+		pw.updateRoutes(pod, app, e.Type)
+		// Conflicts are logged once, not on every event of the pods involved
+		for _, c := range pw.Routes.ChangedConflicts() {
+			manager.GetLogger().Warn("Hostname ", c.Hostname, " is claimed by the apps ", strings.Join(c.Apps, ", "), ", ", c.Apps[0], " serves it")
+		}
+	}
 
 	switch e.Type {
 	case watch.Deleted:
+		if pw.InstanceServices {
+			if err := pw.DeleteInstanceService(clientset, pod); err != nil {
+				manager.GetLogger().Error((err.Error()))
+			}
+		}
 
-		set := labels.Set(app.DesiredService(pw.CustomLabels, pw.CustomAnnotations).Spec.Selector)
+		set := labels.Set(pw.DesiredService(app).Spec.Selector)
 		listOptions := metav1.ListOptions{LabelSelector: set.AsSelector().String()}
 		pods, err := clientset.CoreV1().Pods(pod.GetNamespace()).List(listOptions)
 		if err != nil {
@@ -67,54 +118,213 @@ func (pw *PodWatcher) Handle(manager eirinix.Manager, e watch.Event) {
 			return
 		}
 
-		err = clientset.CoreV1().Services(pod.GetNamespace()).Delete(app.DesiredService(pw.CustomLabels, pw.CustomAnnotations).GetName(), nil)
+		err = clientset.CoreV1().Services(pod.GetNamespace()).Delete(pw.DesiredService(app).GetName(), nil)
 		if err != nil {
 			manager.GetLogger().Error((err.Error()))
 			//	return
 		}
-		fmt.Println("Deleted Services", app.DesiredService(pw.CustomLabels, pw.CustomAnnotations).GetName())
+		fmt.Println("Deleted Services", pw.DesiredService(app).GetName())
 
-		err = clientset.ExtensionsV1beta1().Ingresses(pod.GetNamespace()).Delete(app.DesiredIngress(pw.CustomLabels, pw.CustomAnnotations, pw.TLS).GetName(), nil)
-		if err != nil {
+		// Apps whose routes are all bound to route services have no ingress
+		err = clientset.ExtensionsV1beta1().Ingresses(pod.GetNamespace()).Delete(pw.DesiredIngress(app).GetName(), nil)
+		if err != nil && !apierrors.IsNotFound(err) {
 			manager.GetLogger().Error((err.Error()))
-			return
+		} else if err == nil {
+			fmt.Println("Deleted ingress", pw.DesiredIngress(app).GetName())
 		}
-		fmt.Println("Deleted ingress", app.DesiredIngress(pw.CustomLabels, pw.CustomAnnotations, pw.TLS).GetName())
 
-	default:
-		if svc, err := clientset.CoreV1().Services(pod.GetNamespace()).Get(app.DesiredService(pw.CustomLabels, pw.CustomAnnotations).GetName(), metav1.GetOptions{}); err == nil {
-			svc, err := clientset.CoreV1().Services(pod.GetNamespace()).Update(app.UpdateService(svc, pw.CustomLabels, pw.CustomAnnotations))
-			if err != nil {
-				manager.GetLogger().Error((err.Error()))
-				//	return
+		if pw.TLS && pw.CA != nil {
+			for name := range pw.selfSignedSecrets(pw.DesiredIngress(app)) {
+				secret, err := clientset.CoreV1().Secrets(pod.GetNamespace()).Get(name, metav1.GetOptions{})
+				if err != nil || secret.GetLabels()[IssuerLabel] != SelfSignedIssuer {
+					continue
+				}
+				if err := clientset.CoreV1().Secrets(pod.GetNamespace()).Delete(name, nil); err != nil {
+					manager.GetLogger().Error((err.Error()))
+					continue
+				}
+				fmt.Println("Deleted certificate", name)
 			}
-			fmt.Println("Updated service", svc.GetName())
-		} else {
-			svc, err := clientset.CoreV1().Services(pod.GetNamespace()).Create(app.DesiredService(pw.CustomLabels, pw.CustomAnnotations))
-			if err != nil {
+		}
+
+		if pw.Replicator != nil {
+			if err := pw.Replicator.Sync(clientset, pod.GetNamespace()); err != nil {
 				manager.GetLogger().Error((err.Error()))
-				//	return
 			}
-			fmt.Println("Created service", svc.GetName())
 		}
 
-		if ingr, err := clientset.ExtensionsV1beta1().Ingresses(pod.GetNamespace()).Get(app.DesiredIngress(pw.CustomLabels, pw.CustomAnnotations, pw.TLS).GetName(), metav1.GetOptions{}); err == nil {
-			ingr, err := clientset.ExtensionsV1beta1().Ingresses(pod.GetNamespace()).Update(app.UpdateIngress(ingr, pw.CustomLabels, pw.CustomAnnotations, pw.TLS))
-			if err != nil {
+		if pw.ExternalDNS != nil {
+			if err := pw.deleteDNSEndpoint(manager, pw.DesiredIngress(app)); err != nil {
 				manager.GetLogger().Error((err.Error()))
-				//	return
 			}
-			fmt.Println("Updated Ingress", ingr.GetName())
+		}
+
+	default:
+		dyn, err := pw.dynamicClient(manager)
+		if err != nil {
+			manager.GetLogger().Error((err.Error()))
+		}
+		if err := pw.EnsureApp(clientset, dyn, pod, app); err != nil {
+			manager.GetLogger().Error((err.Error()))
+		}
+	}
+
+	return
+}
+
+// DesiredService returns the desired service of the app with the watcher settings
+func (pw *PodWatcher) DesiredService(app RouteHandler) *corev1.Service {
+	return app.DesiredService(pw.CustomLabels, pw.CustomAnnotations)
+}
+
+// UpdateService updates the service of the app with the watcher settings
+func (pw *PodWatcher) UpdateService(app RouteHandler, svc *corev1.Service) *corev1.Service {
+	return app.UpdateService(svc, pw.CustomLabels, pw.CustomAnnotations)
+}
+
+// DesiredIngress returns the desired ingress of the app with the watcher settings
+func (pw *PodWatcher) DesiredIngress(app RouteHandler) *v1beta1.Ingress {
+	in := app.DesiredIngress(pw.CustomLabels, pw.CustomAnnotations, pw.TLS)
+	if pw.ExternalDNS != nil {
+		pw.ExternalDNS.Annotate(in)
+	}
+	return in
+}
+
+// UpdateIngress updates the ingress of the app with the watcher settings
+func (pw *PodWatcher) UpdateIngress(app RouteHandler, in *v1beta1.Ingress) *v1beta1.Ingress {
+	in = app.UpdateIngress(in, pw.CustomLabels, pw.CustomAnnotations, pw.TLS)
+	if pw.ExternalDNS != nil {
+		pw.ExternalDNS.Annotate(in)
+	}
+	return in
+}
+
+// EnsureApp creates or updates the resources of the app running in the pod, as the watcher does on
+// every pod event: its Service and Ingress, the instance Service, the DNSEndpoint, and the TLS secrets
+// replicated or issued by the CA, whose certificates are then checked. It goes on after failures
+// and returns all of them. dyn is only used for the DNSEndpoints, and can be nil without them.
+func (pw *PodWatcher) EnsureApp(client kubernetes.Interface, dyn dynamic.Interface, pod *corev1.Pod, app RouteHandler) error {
+	errs := []error{}
+	namespace := pod.GetNamespace()
+
+	desiredService := pw.DesiredService(app)
+	if svc, err := client.CoreV1().Services(namespace).Get(desiredService.GetName(), metav1.GetOptions{}); err == nil {
+		if _, err := client.CoreV1().Services(namespace).Update(pw.UpdateService(app, svc)); err != nil {
+			errs = append(errs, err)
+		} else {
+			fmt.Println("Updated service", svc.GetName())
+		}
+	} else if _, err := client.CoreV1().Services(namespace).Create(desiredService); err != nil {
+		errs = append(errs, err)
+	} else {
+		fmt.Println("Created service", desiredService.GetName())
+	}
+
+	// The ingress in the cluster, which carries the load balancer addresses
+	var live *v1beta1.Ingress
+	desiredIngress := pw.DesiredIngress(app)
+	if len(desiredIngress.Spec.Rules) == 0 {
+		// All the routes are bound to route services, which the ingress can't enforce. The ingress
+		// with the name of the app is deleted only if generated, as in Plan.
+		in, err := client.ExtensionsV1beta1().Ingresses(namespace).Get(desiredIngress.GetName(), metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+		case err != nil:
+			errs = append(errs, err)
+		case managedIngress(in, map[string]interface{}{desiredService.GetName(): nil}, pw.AdoptUnlabeled):
+			err := client.ExtensionsV1beta1().Ingresses(namespace).Delete(in.GetName(), nil)
+			if err != nil && !apierrors.IsNotFound(err) {
+				errs = append(errs, err)
+			}
+		}
+	} else if in, err := client.ExtensionsV1beta1().Ingresses(namespace).Get(desiredIngress.GetName(), metav1.GetOptions{}); err == nil {
+		live = in
+		if updated, err := client.ExtensionsV1beta1().Ingresses(namespace).Update(pw.UpdateIngress(app, in)); err != nil {
+			errs = append(errs, err)
 		} else {
-			ingr, err := clientset.ExtensionsV1beta1().Ingresses(pod.GetNamespace()).Create(app.DesiredIngress(pw.CustomLabels, pw.CustomAnnotations, pw.TLS))
+			live = updated
+			fmt.Println("Updated Ingress", live.GetName())
+		}
+	} else if created, err := client.ExtensionsV1beta1().Ingresses(namespace).Create(desiredIngress); err != nil {
+		// The secrets and the records follow the ingress
+		return utilerrors.NewAggregate(append(errs, err))
+	} else {
+		live = created
+		fmt.Println("Created ingress", live.GetName())
+	}
+
+	if pw.InstanceServices {
+		if err := pw.EnsureInstanceService(client, pod); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if pw.ExternalDNS != nil && pw.ExternalDNS.Mode == ExternalDNSEndpoints && live != nil {
+		if dyn == nil {
+			errs = append(errs, fmt.Errorf("no client to publish the DNSEndpoint of %s", live.GetName()))
+		} else if err := pw.ExternalDNS.EnsureEndpoint(dyn, live); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if pw.TLS && pw.Replicator != nil {
+		if err := pw.Replicator.Ensure(client, desiredIngress); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if pw.TLS && pw.CA != nil {
+		for name, hosts := range pw.selfSignedSecrets(desiredIngress) {
+			issued, err := pw.CA.EnsureSecret(client, namespace, name, hosts)
 			if err != nil {
-				manager.GetLogger().Error((err.Error()))
-				return
+				errs = append(errs, err)
+				continue
+			}
+			if issued {
+				fmt.Println("Issued certificate", name)
 			}
-			fmt.Println("Created ingress", ingr.GetName())
 		}
+	}
 
+	if pw.TLS && pw.Monitor != nil {
+		if err := pw.Monitor.Check(client, pod, desiredIngress); err != nil {
+			errs = append(errs, err)
+		}
 	}
+	return utilerrors.NewAggregate(errs)
+}
 
-	return
+// dynamicClient returns a dynamic client if the watcher manages DNSEndpoints, nil otherwise
+func (pw *PodWatcher) dynamicClient(manager eirinix.Manager) (dynamic.Interface, error) {
+	if pw.ExternalDNS == nil || pw.ExternalDNS.Mode != ExternalDNSEndpoints {
+		return nil, nil
+	}
+	return getDynamicClient(manager)
+}
+
+func (pw *PodWatcher) deleteDNSEndpoint(manager eirinix.Manager, in *v1beta1.Ingress) error {
+	dyn, err := pw.dynamicClient(manager)
+	if err != nil || dyn == nil {
+		return err
+	}
+	return pw.ExternalDNS.DeleteEndpoint(dyn, in.GetNamespace(), in.GetName())
+}
+
+// selfSignedSecrets returns the hosts of the TLS secrets in the ingress which are handled by the CA.
+// Shared secrets from the domain mapping are never issued by the CA.
+func (pw *PodWatcher) selfSignedSecrets(in *v1beta1.Ingress) map[string][]string {
+	shared := map[string]interface{}{}
+	for _, secret := range pw.TLSSecrets {
+		shared[secret] = nil
+	}
+
+	secrets := map[string][]string{}
+	for _, t := range in.Spec.TLS {
+		if _, ok := shared[t.SecretName]; ok {
+			continue
+		}
+		secrets[t.SecretName] = append(secrets[t.SecretName], t.Hosts...)
+	}
+	return secrets
 }
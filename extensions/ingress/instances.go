@@ -0,0 +1,106 @@
+package ingress
+
+import (
+	"fmt"
+	"time"
+
+	eirinix "github.com/SUSE/eirinix"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DesiredInstanceService returns the desired service of the app instance running in the pod
+func (pw *PodWatcher) DesiredInstanceService(pod *corev1.Pod) *corev1.Service {
+	return NewEiriniApp(pod).DesiredInstanceService(pw.CustomLabels, pw.CustomAnnotations)
+}
+
+// EnsureInstanceService creates or updates the service of the app instance running in the pod
+func (pw *PodWatcher) EnsureInstanceService(client kubernetes.Interface, pod *corev1.Pod) error {
+	desired := pw.DesiredInstanceService(pod)
+	svc, err := client.CoreV1().Services(pod.GetNamespace()).Get(desired.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		if _, err := client.CoreV1().Services(pod.GetNamespace()).Create(desired); err != nil {
+			return err
+		}
+		fmt.Println("Created instance service", desired.GetName())
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	svc.Labels = desired.Labels
+	svc.Annotations = desired.Annotations
+	svc.Spec.Ports = desired.Spec.Ports
+	svc.Spec.Selector = desired.Spec.Selector
+	_, err = client.CoreV1().Services(pod.GetNamespace()).Update(svc)
+	return err
+}
+
+// DeleteInstanceService deletes the service of the app instance running in the pod
+func (pw *PodWatcher) DeleteInstanceService(client kubernetes.Interface, pod *corev1.Pod) error {
+	name := pw.DesiredInstanceService(pod).GetName()
+	if err := client.CoreV1().Services(pod.GetNamespace()).Delete(name, nil); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	fmt.Println("Deleted instance service", name)
+	return nil
+}
+
+// SyncInstanceServices deletes the instance services of the namespace whose pod is gone,
+// e.g. after a scale-down missed by the watcher
+func (pw *PodWatcher) SyncInstanceServices(client kubernetes.Interface, namespace string) error {
+	selector := labels.NewSelector()
+	requirement, err := labels.NewRequirement(InstanceServiceLabel, selection.Exists, nil)
+	if err != nil {
+		return err
+	}
+	selector = selector.Add(*requirement)
+	services, err := client.CoreV1().Services(namespace).List(metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return err
+	}
+
+	for _, svc := range services.Items {
+		pod := svc.Spec.Selector[PodNameLabel]
+		if pod != "" {
+			_, err := client.CoreV1().Pods(namespace).Get(pod, metav1.GetOptions{})
+			if err == nil {
+				continue
+			}
+			if !apierrors.IsNotFound(err) {
+				return err
+			}
+		}
+		if err := client.CoreV1().Services(namespace).Delete(svc.GetName(), nil); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		fmt.Println("Deleted instance service", svc.GetName())
+	}
+	return nil
+}
+
+// RunInstanceServiceSync periodically deletes the instance services without pod until stop is closed
+func (pw *PodWatcher) RunInstanceServiceSync(manager eirinix.Manager, namespace string, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		clientset, err := getClientSet(manager)
+		if err == nil {
+			err = pw.SyncInstanceServices(clientset, namespace)
+		}
+		if err != nil {
+			manager.GetLogger().Error("Failed syncing instance services: ", err.Error())
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
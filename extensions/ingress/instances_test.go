@@ -0,0 +1,63 @@
+package ingress_test
+
+import (
+	. "github.com/mudler/eirini-ingress/extensions/ingress"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Instance services", func() {
+	var (
+		pw     *PodWatcher
+		client *fake.Clientset
+		pod    *corev1.Pod
+	)
+
+	BeforeEach(func() {
+		pw = NewPodWatcher(map[string]string{"custom": "label"}, nil)
+		pw.InstanceServices = true
+		pod = appPod("foo", "foo-guid", "1", `[{"hostname":"foo.example.com","port":8080}]`)
+		client = fake.NewSimpleClientset(pod)
+	})
+
+	It("selects only the pod of the instance", func() {
+		svc := pw.DesiredInstanceService(pod)
+		Expect(svc.GetName()).To(Equal("foo-instance-1"))
+		Expect(svc.Spec.Selector).To(Equal(map[string]string{PodNameLabel: "foo-1"}))
+		Expect(svc.Spec.Ports[0].Port).To(Equal(int32(8080)))
+		Expect(svc.GetLabels()).To(Equal(map[string]string{"custom": "label", InstanceServiceLabel: "foo", ManagedByLabel: ManagedBy}))
+		Expect(pw.CustomLabels).To(Equal(map[string]string{"custom": "label"}))
+	})
+
+	It("creates, updates and deletes the service of the instance", func() {
+		Expect(pw.EnsureInstanceService(client, pod)).To(Succeed())
+		Expect(pw.EnsureInstanceService(client, pod)).To(Succeed())
+		_, err := client.CoreV1().Services("eirini").Get("foo-instance-1", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(pw.DeleteInstanceService(client, pod)).To(Succeed())
+		_, err = client.CoreV1().Services("eirini").Get("foo-instance-1", metav1.GetOptions{})
+		Expect(err).To(HaveOccurred())
+		Expect(pw.DeleteInstanceService(client, pod)).To(Succeed())
+	})
+
+	It("deletes the services of the instances which are gone", func() {
+		gone := appPod("foo", "foo-guid", "2", `[{"hostname":"foo.example.com","port":8080}]`)
+		Expect(pw.EnsureInstanceService(client, pod)).To(Succeed())
+		Expect(pw.EnsureInstanceService(client, gone)).To(Succeed())
+		_, err := client.CoreV1().Services("eirini").Create(&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "other"}})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(pw.SyncInstanceServices(client, "eirini")).To(Succeed())
+		services, err := client.CoreV1().Services("eirini").List(metav1.ListOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		names := []string{}
+		for _, s := range services.Items {
+			names = append(names, s.GetName())
+		}
+		Expect(names).To(ConsistOf("foo-instance-1", "other"))
+	})
+})
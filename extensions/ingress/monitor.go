@@ -0,0 +1,178 @@
+package ingress
+
+import (
+	"fmt"
+	"time"
+
+	eirinix "github.com/SUSE/eirinix"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	// ReasonCertificateExpired is the event reason for expired certificates
+	ReasonCertificateExpired = "CertificateExpired"
+	// ReasonCertificateExpiring is the event reason for certificates expiring soon
+	ReasonCertificateExpiring = "CertificateExpiring"
+	// ReasonCertificateHostMismatch is the event reason for certificates not covering a routed hostname
+	ReasonCertificateHostMismatch = "CertificateHostMismatch"
+	// ReasonCertificateInvalid is the event reason for missing or unparsable TLS secrets
+	ReasonCertificateInvalid = "CertificateInvalid"
+)
+
+// CertificateExpiryDays exports the days left before the certificate of a TLS secret expires
+var CertificateExpiryDays = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "eirini_ingress_tls_certificate_expiry_days",
+		Help: "Days left before the certificate in the TLS secret expires",
+	},
+	[]string{"namespace", "secret"},
+)
+
+func init() {
+	prometheus.MustRegister(CertificateExpiryDays)
+}
+
+// CertificateMonitor checks the certificates in the TLS secrets referenced by the generated ingresses
+type CertificateMonitor struct {
+	Recorder record.EventRecorder
+	// WarnBefore is the time before expiry when certificates are reported as expiring soon
+	WarnBefore time.Duration
+}
+
+// NewCertificateMonitor returns a CertificateMonitor emitting events with the given recorder
+func NewCertificateMonitor(recorder record.EventRecorder) *CertificateMonitor {
+	return &CertificateMonitor{Recorder: recorder, WarnBefore: 14 * 24 * time.Hour}
+}
+
+// NewEventRecorder returns an event recorder which sends events to the cluster the manager is connected to
+func NewEventRecorder(manager eirinix.Manager) (record.EventRecorder, error) {
+	clientset, err := getClientSet(manager)
+	if err != nil {
+		return nil, err
+	}
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	return broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "eirini-ingress"}), nil
+}
+
+// Check verifies the certificates of the TLS secrets referenced by the ingress, and emits Warning
+// events on the app for expired, expiring and mismatching certificates.
+func (m *CertificateMonitor) Check(client kubernetes.Interface, pod *corev1.Pod, in *v1beta1.Ingress) error {
+	ref := appReference(pod)
+	hosts := map[string][]string{}
+	for _, t := range in.Spec.TLS {
+		hosts[t.SecretName] = append(hosts[t.SecretName], t.Hosts...)
+	}
+
+	for name, secretHosts := range hosts {
+		secret, err := client.CoreV1().Secrets(in.GetNamespace()).Get(name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			m.Recorder.Eventf(ref, corev1.EventTypeWarning, ReasonCertificateInvalid, "TLS secret %s not found", name)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		cert, err := parseCertificate(secret.Data[corev1.TLSCertKey])
+		if err != nil {
+			m.Recorder.Eventf(ref, corev1.EventTypeWarning, ReasonCertificateInvalid, "Invalid certificate in TLS secret %s: %s", name, err.Error())
+			continue
+		}
+
+		left := time.Until(cert.NotAfter)
+		CertificateExpiryDays.WithLabelValues(in.GetNamespace(), name).Set(left.Hours() / 24)
+		switch {
+		case left <= 0:
+			m.Recorder.Eventf(ref, corev1.EventTypeWarning, ReasonCertificateExpired, "Certificate in TLS secret %s expired on %s", name, cert.NotAfter.Format(time.RFC3339))
+		case left < m.WarnBefore:
+			m.Recorder.Eventf(ref, corev1.EventTypeWarning, ReasonCertificateExpiring, "Certificate in TLS secret %s expires on %s", name, cert.NotAfter.Format(time.RFC3339))
+		}
+
+		for _, host := range uniqueSorted(secretHosts) {
+			if err := cert.VerifyHostname(host); err != nil {
+				m.Recorder.Eventf(ref, corev1.EventTypeWarning, ReasonCertificateHostMismatch, "Certificate in TLS secret %s does not cover %s", name, host)
+			}
+		}
+	}
+	return nil
+}
+
+// appReference returns the object events about the app are attached to: the StatefulSet
+// owning the pod if there is one, or the pod itself.
+func appReference(pod *corev1.Pod) *corev1.ObjectReference {
+	for _, owner := range pod.GetOwnerReferences() {
+		if owner.Kind == "StatefulSet" {
+			return &corev1.ObjectReference{
+				APIVersion: owner.APIVersion,
+				Kind:       owner.Kind,
+				Name:       owner.Name,
+				UID:        owner.UID,
+				Namespace:  pod.GetNamespace(),
+			}
+		}
+	}
+	return &corev1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Name:       pod.GetName(),
+		UID:        pod.GetUID(),
+		Namespace:  pod.GetNamespace(),
+	}
+}
+
+// RunCertificateMonitor periodically checks the certificates of all the apps in the namespace until stop is closed
+func (pw *PodWatcher) RunCertificateMonitor(manager eirinix.Manager, namespace string, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := pw.checkCertificates(manager, namespace); err != nil {
+			manager.GetLogger().Error("Failed checking certificates: ", err.Error())
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (pw *PodWatcher) checkCertificates(manager eirinix.Manager, namespace string) error {
+	clientset, err := getClientSet(manager)
+	if err != nil {
+		return err
+	}
+	pods, err := clientset.CoreV1().Pods(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	// Drop the gauges of secrets which are not referenced anymore
+	CertificateExpiryDays.Reset()
+	checked := map[string]interface{}{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		app := pw.GetRouteHandler(pod)
+		if !app.Validate() {
+			continue
+		}
+		in := pw.DesiredIngress(app)
+		if _, ok := checked[in.GetName()]; ok {
+			continue
+		}
+		checked[in.GetName()] = nil
+		if err := pw.Monitor.Check(clientset, pod, in); err != nil {
+			return fmt.Errorf("checking %s: %s", in.GetName(), err.Error())
+		}
+	}
+	return nil
+}
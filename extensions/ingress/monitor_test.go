@@ -0,0 +1,55 @@
+package ingress_test
+
+import (
+	"time"
+
+	. "github.com/mudler/eirini-ingress/extensions/ingress"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+var _ = Describe("Certificate monitor", func() {
+	var (
+		client   *fake.Clientset
+		recorder *record.FakeRecorder
+		monitor  *CertificateMonitor
+		pod      *corev1.Pod
+		in       *v1beta1.Ingress
+	)
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		recorder = record.NewFakeRecorder(10)
+		monitor = NewCertificateMonitor(recorder)
+		pod = &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "eirini", Name: "foo-0"}}
+		in = &v1beta1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "eirini", Name: "foo"},
+			Spec: v1beta1.IngressSpec{
+				TLS: []v1beta1.IngressTLS{{Hosts: []string{"foo.example.com", "bar.example.com"}, SecretName: "foo-tls"}},
+			},
+		}
+
+		ca := NewSelfSignedCA("eirini", "ca")
+		ca.Validity = 24 * time.Hour
+		_, err := ca.EnsureSecret(client, "eirini", "foo-tls", []string{"foo.example.com"})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("reports expiring certificates and uncovered hosts", func() {
+		Expect(monitor.Check(client, pod, in)).To(Succeed())
+		Expect(recorder.Events).To(Receive(ContainSubstring(ReasonCertificateExpiring)))
+		Expect(recorder.Events).To(Receive(ContainSubstring("does not cover bar.example.com")))
+		Expect(recorder.Events).ToNot(Receive())
+	})
+
+	It("reports missing secrets", func() {
+		in.Spec.TLS[0].SecretName = "missing-tls"
+		Expect(monitor.Check(client, pod, in)).To(Succeed())
+		Expect(recorder.Events).To(Receive(ContainSubstring(ReasonCertificateInvalid)))
+	})
+})
@@ -0,0 +1,232 @@
+package ingress
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	eirinix "github.com/SUSE/eirinix"
+	nats "github.com/nats-io/nats.go"
+)
+
+const (
+	// RouterRegisterSubject is the NATS subject gorouter receives the route registrations on
+	RouterRegisterSubject = "router.register"
+	// RouterUnregisterSubject is the NATS subject gorouter receives the route removals on
+	RouterUnregisterSubject = "router.unregister"
+	// RouterStartSubject is the NATS subject gorouter announces itself on
+	RouterStartSubject = "router.start"
+	// RouterGreetSubject is the NATS subject used to ask the running gorouters to announce themselves
+	RouterGreetSubject = "router.greet"
+
+	// DefaultRegisterInterval is used until a gorouter announces its own interval
+	DefaultRegisterInterval = 20 * time.Second
+	// DefaultStaleThreshold is the time after which gorouter prunes routes which are not registered again
+	DefaultStaleThreshold = 120
+)
+
+// RouterRegistration is a gorouter `router.register` and `router.unregister` message,
+// routing the URIs to an app instance
+type RouterRegistration struct {
+	Host                 string            `json:"host"`
+	Port                 int               `json:"port"`
+	URIs                 []string          `json:"uris"`
+	App                  string            `json:"app,omitempty"`
+	PrivateInstanceID    string            `json:"private_instance_id,omitempty"`
+	PrivateInstanceIndex string            `json:"private_instance_index,omitempty"`
+	RouteServiceURL      string            `json:"route_service_url,omitempty"`
+	Tags                 map[string]string `json:"tags,omitempty"`
+	StaleThreshold       int               `json:"stale_threshold_in_seconds,omitempty"`
+}
+
+// RouterStart is the `router.start` message gorouter sends when it starts, and in reply to `router.greet`
+type RouterStart struct {
+	ID                      string   `json:"id"`
+	Hosts                   []string `json:"hosts"`
+	MinimumRegisterInterval int      `json:"minimumRegisterIntervalInSeconds"`
+	PruneThreshold          int      `json:"pruneThresholdInSeconds"`
+}
+
+// Publisher publishes NATS messages, it is implemented by nats.Conn
+type Publisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// RouteEmitter registers the routes of the RouteTable to gorouter over NATS, as the
+// Cloud Foundry route-emitter does. Each ready app instance is registered with the
+// hostnames of its ports, and registrations are published again every register interval.
+type RouteEmitter struct {
+	Routes    *RouteTable
+	Publisher Publisher
+	// StaleThreshold is the time in seconds after which gorouter prunes the routes which are not registered again
+	StaleThreshold int
+
+	mu         sync.Mutex
+	registered map[string]RouterRegistration
+}
+
+// NewRouteEmitter returns a RouteEmitter for the route table
+func NewRouteEmitter(routes *RouteTable, publisher Publisher) *RouteEmitter {
+	return &RouteEmitter{
+		Routes:         routes,
+		Publisher:      publisher,
+		StaleThreshold: DefaultStaleThreshold,
+		registered:     map[string]RouterRegistration{},
+	}
+}
+
+// Registrations returns the registrations of the ready app instances, by instance, port
+// and route service
+func (e *RouteEmitter) Registrations() map[string]RouterRegistration {
+	type target struct {
+		port         int
+		routeService string
+	}
+
+	registrations := map[string]RouterRegistration{}
+	for _, app := range e.Routes.Apps() {
+		uris := map[target][]string{}
+		for _, r := range app.Routes {
+			t := target{port: r.Port, routeService: r.RouteServiceURL}
+			if !containsString(uris[t], strings.ToLower(r.Hostname)) {
+				uris[t] = append(uris[t], strings.ToLower(r.Hostname))
+			}
+		}
+		for _, hosts := range uris {
+			sort.Strings(hosts)
+		}
+		for _, i := range sortedInstances(app) {
+			if !i.Ready || i.IP == "" {
+				continue
+			}
+			for t, hosts := range uris {
+				key := fmt.Sprintf("%s/%s:%d", app.Namespace, i.PodName, t.port)
+				if t.routeService != "" {
+					key += " " + t.routeService
+				}
+				registrations[key] = RouterRegistration{
+					Host:                 i.IP,
+					Port:                 t.port,
+					URIs:                 hosts,
+					App:                  app.GUID,
+					PrivateInstanceID:    i.PodName,
+					PrivateInstanceIndex: i.InstanceID,
+					RouteServiceURL:      t.routeService,
+					Tags:                 map[string]string{"component": "eirini-ingress", "namespace": app.Namespace},
+					StaleThreshold:       e.StaleThreshold,
+				}
+			}
+		}
+	}
+	return registrations
+}
+
+func (e *RouteEmitter) publish(subject string, r RouterRegistration) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return e.Publisher.Publish(subject, data)
+}
+
+// Emit publishes the changes of the route table since the last call: instances which are gone
+// are unregistered, and new ones registered. If all is true every registration is published again.
+func (e *RouteEmitter) Emit(all bool) error {
+	desired := e.Registrations()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for key, old := range e.registered {
+		if current, ok := desired[key]; !ok || !reflect.DeepEqual(current.URIs, old.URIs) || current.Host != old.Host {
+			if err := e.publish(RouterUnregisterSubject, old); err != nil {
+				return err
+			}
+			delete(e.registered, key)
+		}
+	}
+	for key, r := range desired {
+		if old, ok := e.registered[key]; !all && ok && reflect.DeepEqual(old, r) {
+			continue
+		}
+		if err := e.publish(RouterRegisterSubject, r); err != nil {
+			return err
+		}
+		e.registered[key] = r
+	}
+	return nil
+}
+
+// Run connects to NATS and registers the routes until stop is closed. Registrations are published
+// again on the interval announced by gorouter in `router.start`, and every time a gorouter starts.
+func (e *RouteEmitter) Run(manager eirinix.Manager, url string, stop <-chan struct{}) error {
+	conn, err := nats.Connect(url, nats.Name("eirini-ingress"), nats.MaxReconnects(-1))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	e.Publisher = conn
+
+	starts := make(chan RouterStart, 16)
+	onStart := func(msg *nats.Msg) {
+		var start RouterStart
+		if err := json.Unmarshal(msg.Data, &start); err != nil {
+			manager.GetLogger().Error("Invalid router.start message: ", err.Error())
+			return
+		}
+		select {
+		case starts <- start:
+		default:
+		}
+	}
+	sub, err := conn.Subscribe(RouterStartSubject, onStart)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	// Ask the running gorouters for their register interval
+	inbox := nats.NewInbox()
+	greet, err := conn.Subscribe(inbox, onStart)
+	if err != nil {
+		return err
+	}
+	defer greet.Unsubscribe()
+	if err := conn.PublishRequest(RouterGreetSubject, inbox, []byte{}); err != nil {
+		return err
+	}
+
+	events, cancel := e.Routes.Subscribe()
+	defer cancel()
+
+	interval := DefaultRegisterInterval
+	ticker := time.NewTicker(interval)
+	defer func() { ticker.Stop() }()
+	emit := func(all bool) {
+		if err := e.Emit(all); err != nil {
+			manager.GetLogger().Error(err.Error())
+		}
+	}
+	emit(true)
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			emit(true)
+		case <-events:
+			emit(false)
+		case start := <-starts:
+			if d := time.Duration(start.MinimumRegisterInterval) * time.Second; d > 0 && d != interval {
+				interval = d
+				ticker.Stop()
+				ticker = time.NewTicker(interval)
+			}
+			emit(true)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package ingress_test
+
+import (
+	"encoding/json"
+
+	. "github.com/mudler/eirini-ingress/extensions/ingress"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+)
+
+type natsMessage struct {
+	Subject      string
+	Registration RouterRegistration
+}
+
+type recordingPublisher struct {
+	messages []natsMessage
+}
+
+func (p *recordingPublisher) Publish(subject string, data []byte) error {
+	var r RouterRegistration
+	if err := json.Unmarshal(data, &r); err != nil {
+		return err
+	}
+	p.messages = append(p.messages, natsMessage{Subject: subject, Registration: r})
+	return nil
+}
+
+var _ = Describe("Route emitter", func() {
+	var (
+		routes    *RouteTable
+		publisher *recordingPublisher
+		emitter   *RouteEmitter
+	)
+
+	BeforeEach(func() {
+		routes = NewRouteTable()
+		for _, pod := range []*corev1.Pod{
+			appPod("foo", "foo-guid", "0", `[{"hostname":"foo.example.com","port":8080},{"hostname":"www.example.com","port":8080}]`),
+			appPod("foo", "foo-guid", "1", `[{"hostname":"foo.example.com","port":8080},{"hostname":"www.example.com","port":8080}]`),
+		} {
+			routes.Update(NewEiriniApp(pod), pod, "foo", "foo")
+		}
+		publisher = &recordingPublisher{}
+		emitter = NewRouteEmitter(routes, publisher)
+	})
+
+	It("registers every ready instance in the gorouter format", func() {
+		Expect(emitter.Emit(false)).To(Succeed())
+		Expect(publisher.messages).To(HaveLen(2))
+		Expect(publisher.messages[0].Subject).To(Equal(RouterRegisterSubject))
+		Expect(publisher.messages).To(ContainElement(natsMessage{
+			Subject: RouterRegisterSubject,
+			Registration: RouterRegistration{
+				Host:                 "10.1.0.1",
+				Port:                 8080,
+				URIs:                 []string{"foo.example.com", "www.example.com"},
+				App:                  "foo-guid",
+				PrivateInstanceID:    "foo-1",
+				PrivateInstanceIndex: "1",
+				Tags:                 map[string]string{"component": "eirini-ingress", "namespace": "eirini"},
+				StaleThreshold:       DefaultStaleThreshold,
+			},
+		}))
+	})
+
+	It("publishes only the changes, unless asked to publish everything", func() {
+		Expect(emitter.Emit(false)).To(Succeed())
+		publisher.messages = nil
+		Expect(emitter.Emit(false)).To(Succeed())
+		Expect(publisher.messages).To(BeEmpty())
+		Expect(emitter.Emit(true)).To(Succeed())
+		Expect(publisher.messages).To(HaveLen(2))
+	})
+
+	It("unregisters the instances which are gone or not ready", func() {
+		Expect(emitter.Emit(false)).To(Succeed())
+		publisher.messages = nil
+
+		pod := appPod("foo", "foo-guid", "1", `[{"hostname":"foo.example.com","port":8080},{"hostname":"www.example.com","port":8080}]`)
+		pod.Status.Conditions[0].Status = corev1.ConditionFalse
+		routes.Update(NewEiriniApp(pod), pod, "foo", "foo")
+		Expect(emitter.Emit(false)).To(Succeed())
+		Expect(publisher.messages).To(HaveLen(1))
+		Expect(publisher.messages[0].Subject).To(Equal(RouterUnregisterSubject))
+		Expect(publisher.messages[0].Registration.PrivateInstanceID).To(Equal("foo-1"))
+	})
+})
@@ -0,0 +1,248 @@
+package ingress
+
+import (
+	"fmt"
+	"sort"
+
+	eirinix "github.com/SUSE/eirinix"
+	corev1 "k8s.io/api/core/v1"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// ActionCreate is the action of the changes creating a missing resource
+	ActionCreate = "create"
+	// ActionUpdate is the action of the changes updating a resource which differs from the desired state
+	ActionUpdate = "update"
+	// ActionDelete is the action of the changes deleting a resource of an app which is gone
+	ActionDelete = "delete"
+)
+
+// FieldChange is a field of a resource which differs from the desired state
+type FieldChange struct {
+	Path    string      `json:"path"`
+	Current interface{} `json:"current"`
+	Desired interface{} `json:"desired"`
+}
+
+// Change is a difference between a generated resource in the cluster and its desired state
+type Change struct {
+	Action    string        `json:"action"`
+	Kind      string        `json:"kind"`
+	Namespace string        `json:"namespace"`
+	Name      string        `json:"name"`
+	Fields    []FieldChange `json:"fields,omitempty"`
+	// Object is the resource to create or update, nil for deletions
+	Object runtime.Object `json:"-"`
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s %s %s/%s", c.Action, c.Kind, c.Namespace, c.Name)
+}
+
+func diffField(fields []FieldChange, path string, current, desired interface{}) []FieldChange {
+	if equality.Semantic.DeepEqual(current, desired) {
+		return fields
+	}
+	return append(fields, FieldChange{Path: path, Current: current, Desired: desired})
+}
+
+// diffService returns the service updated to the desired state, and the fields which differ
+func diffService(current, desired *corev1.Service) (*corev1.Service, []FieldChange) {
+	updated := current.DeepCopy()
+	updated.Labels = desired.Labels
+	updated.Annotations = desired.Annotations
+	updated.Spec.Ports = desired.Spec.Ports
+	updated.Spec.Selector = desired.Spec.Selector
+	fields := diffField(nil, "metadata.labels", current.Labels, desired.Labels)
+	fields = diffField(fields, "metadata.annotations", current.Annotations, desired.Annotations)
+	fields = diffField(fields, "spec.ports", current.Spec.Ports, desired.Spec.Ports)
+	fields = diffField(fields, "spec.selector", current.Spec.Selector, desired.Spec.Selector)
+	return updated, fields
+}
+
+// diffIngress returns the ingress updated to the desired state, and the fields which differ
+func diffIngress(current, desired *v1beta1.Ingress) (*v1beta1.Ingress, []FieldChange) {
+	updated := current.DeepCopy()
+	updated.Labels = desired.Labels
+	updated.Annotations = desired.Annotations
+	updated.Spec.Rules = desired.Spec.Rules
+	updated.Spec.TLS = desired.Spec.TLS
+	fields := diffField(nil, "metadata.labels", current.Labels, desired.Labels)
+	fields = diffField(fields, "metadata.annotations", current.Annotations, desired.Annotations)
+	fields = diffField(fields, "spec.rules", current.Spec.Rules, desired.Spec.Rules)
+	fields = diffField(fields, "spec.tls", current.Spec.TLS, desired.Spec.TLS)
+	return updated, fields
+}
+
+// Plan compares the Services and Ingresses in the namespace with the desired state of its apps,
+// and returns the changes needed to reconcile them, sorted by kind and name. It doesn't write anything.
+// Resources of apps without pods left are deleted, if they carry the ownership label (see AdoptUnlabeled).
+func (pw *PodWatcher) Plan(client kubernetes.Interface, namespace string) ([]Change, error) {
+	pods, err := client.CoreV1().Pods(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	services := map[string]*corev1.Service{}
+	ingresses := map[string]*v1beta1.Ingress{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		app := pw.GetRouteHandler(pod)
+		if !app.Validate() {
+			continue
+		}
+		svc := pw.DesiredService(app)
+		services[svc.GetName()] = svc
+		// Apps whose routes are all bound to route services have no ingress
+		if in := pw.DesiredIngress(app); len(in.Spec.Rules) != 0 {
+			ingresses[in.GetName()] = in
+		}
+		if pw.InstanceServices {
+			svc := pw.DesiredInstanceService(pod)
+			services[svc.GetName()] = svc
+		}
+	}
+
+	changes := []Change{}
+	currentServices, err := client.CoreV1().Services(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	managedServices := map[string]interface{}{}
+	for i := range currentServices.Items {
+		current := &currentServices.Items[i]
+		desired, ok := services[current.GetName()]
+		if !ok {
+			if managedService(current, pw.AdoptUnlabeled) {
+				managedServices[current.GetName()] = nil
+				changes = append(changes, Change{Action: ActionDelete, Kind: "Service", Namespace: namespace, Name: current.GetName()})
+			}
+			continue
+		}
+		delete(services, current.GetName())
+
+		updated, fields := diffService(current, desired)
+		if len(fields) != 0 {
+			changes = append(changes, Change{Action: ActionUpdate, Kind: "Service", Namespace: namespace, Name: current.GetName(), Fields: fields, Object: updated})
+		}
+	}
+	for name, svc := range services {
+		changes = append(changes, Change{Action: ActionCreate, Kind: "Service", Namespace: namespace, Name: name, Object: svc})
+	}
+
+	currentIngresses, err := client.ExtensionsV1beta1().Ingresses(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for i := range currentIngresses.Items {
+		current := &currentIngresses.Items[i]
+		desired, ok := ingresses[current.GetName()]
+		if !ok {
+			if managedIngress(current, managedServices, pw.AdoptUnlabeled) {
+				changes = append(changes, Change{Action: ActionDelete, Kind: "Ingress", Namespace: namespace, Name: current.GetName()})
+			}
+			continue
+		}
+		delete(ingresses, current.GetName())
+
+		updated, fields := diffIngress(current, desired)
+		if len(fields) != 0 {
+			changes = append(changes, Change{Action: ActionUpdate, Kind: "Ingress", Namespace: namespace, Name: current.GetName(), Fields: fields, Object: updated})
+		}
+	}
+	for name, in := range ingresses {
+		changes = append(changes, Change{Action: ActionCreate, Kind: "Ingress", Namespace: namespace, Name: name, Object: in})
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].Kind != changes[j].Kind {
+			return changes[i].Kind > changes[j].Kind
+		}
+		return changes[i].Name < changes[j].Name
+	})
+	return changes, nil
+}
+
+// managedService returns true if the service was generated for an Eirini app. Services generated
+// before the ownership label are recognized by their selector only when adopting unlabeled resources.
+func managedService(svc *corev1.Service, adoptUnlabeled bool) bool {
+	if svc.GetLabels()[ManagedByLabel] == ManagedBy {
+		return true
+	}
+	if _, ok := svc.GetLabels()[InstanceServiceLabel]; ok {
+		return true
+	}
+	if !adoptUnlabeled {
+		return false
+	}
+	_, ok := svc.Spec.Selector[eirinix.LabelGUID]
+	return ok && len(svc.Spec.Selector) == 1
+}
+
+// managedIngress returns true if the ingress was generated for an Eirini app. Ingresses generated
+// before the ownership label are recognized routing only to the service named after them, which
+// was generated too, only when adopting unlabeled resources.
+func managedIngress(in *v1beta1.Ingress, managedServices map[string]interface{}, adoptUnlabeled bool) bool {
+	if in.GetLabels()[ManagedByLabel] == ManagedBy {
+		return true
+	}
+	if !adoptUnlabeled {
+		return false
+	}
+	if _, ok := managedServices[in.GetName()]; !ok || len(in.Spec.Rules) == 0 {
+		return false
+	}
+	for _, r := range in.Spec.Rules {
+		if r.HTTP == nil {
+			return false
+		}
+		for _, p := range r.HTTP.Paths {
+			if p.Backend.ServiceName != in.GetName() {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Apply makes the changes in the cluster, returning the ones which failed with their error
+func (pw *PodWatcher) Apply(client kubernetes.Interface, changes []Change) map[string]error {
+	failed := map[string]error{}
+	for _, c := range changes {
+		var err error
+		switch c.Action {
+		case ActionCreate:
+			switch obj := c.Object.(type) {
+			case *corev1.Service:
+				_, err = client.CoreV1().Services(c.Namespace).Create(obj)
+			case *v1beta1.Ingress:
+				_, err = client.ExtensionsV1beta1().Ingresses(c.Namespace).Create(obj)
+			}
+		case ActionUpdate:
+			switch obj := c.Object.(type) {
+			case *corev1.Service:
+				_, err = client.CoreV1().Services(c.Namespace).Update(obj)
+			case *v1beta1.Ingress:
+				_, err = client.ExtensionsV1beta1().Ingresses(c.Namespace).Update(obj)
+			}
+		case ActionDelete:
+			if c.Kind == "Service" {
+				err = client.CoreV1().Services(c.Namespace).Delete(c.Name, nil)
+			} else {
+				err = client.ExtensionsV1beta1().Ingresses(c.Namespace).Delete(c.Name, nil)
+			}
+			if apierrors.IsNotFound(err) {
+				err = nil
+			}
+		}
+		if err != nil {
+			failed[c.String()] = err
+		}
+	}
+	return failed
+}
@@ -0,0 +1,149 @@
+package ingress_test
+
+import (
+	eirinix "github.com/SUSE/eirinix"
+	. "github.com/mudler/eirini-ingress/extensions/ingress"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Plan", func() {
+	var (
+		pw     *PodWatcher
+		client *fake.Clientset
+	)
+
+	summary := func(changes []Change) []string {
+		s := []string{}
+		for _, c := range changes {
+			s = append(s, c.String())
+		}
+		return s
+	}
+
+	BeforeEach(func() {
+		pw = NewPodWatcher(map[string]string{"custom": "label"}, nil)
+		client = fake.NewSimpleClientset(
+			appPod("foo", "foo-guid", "0", `[{"hostname":"foo.example.com","port":8080}]`),
+			appPod("foo", "foo-guid", "1", `[{"hostname":"foo.example.com","port":8080}]`),
+			appPod("bar", "bar-guid", "0", `[{"hostname":"bar.example.com","port":8080}]`),
+		)
+	})
+
+	It("creates the missing resources", func() {
+		changes, err := pw.Plan(client, "eirini")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary(changes)).To(Equal([]string{
+			"create Service eirini/bar",
+			"create Service eirini/foo",
+			"create Ingress eirini/bar",
+			"create Ingress eirini/foo",
+		}))
+	})
+
+	It("is empty once the changes are applied", func() {
+		changes, err := pw.Plan(client, "eirini")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pw.Apply(client, changes)).To(BeEmpty())
+
+		changes, err = pw.Plan(client, "eirini")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(changes).To(BeEmpty())
+	})
+
+	It("shows the fields to update", func() {
+		changes, err := pw.Plan(client, "eirini")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pw.Apply(client, changes)).To(BeEmpty())
+
+		pw.CustomLabels = map[string]string{"custom": "changed"}
+		changes, err = pw.Plan(client, "eirini")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary(changes)).To(Equal([]string{
+			"update Service eirini/bar",
+			"update Service eirini/foo",
+			"update Ingress eirini/bar",
+			"update Ingress eirini/foo",
+		}))
+		Expect(changes[0].Fields).To(Equal([]FieldChange{{
+			Path:    "metadata.labels",
+			Current: map[string]string{"custom": "label", ManagedByLabel: ManagedBy},
+			Desired: map[string]string{"custom": "changed", ManagedByLabel: ManagedBy},
+		}}))
+
+		Expect(pw.Apply(client, changes)).To(BeEmpty())
+		svc, err := client.CoreV1().Services("eirini").Get("foo", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(svc.GetLabels()).To(Equal(map[string]string{"custom": "changed", ManagedByLabel: ManagedBy}))
+	})
+
+	It("deletes the resources of the apps which are gone, leaving the others", func() {
+		changes, err := pw.Plan(client, "eirini")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pw.Apply(client, changes)).To(BeEmpty())
+
+		Expect(client.CoreV1().Pods("eirini").Delete("bar-0", nil)).To(Succeed())
+		_, err = client.CoreV1().Services("eirini").Create(&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "other"},
+			Spec:       corev1.ServiceSpec{Selector: map[string]string{eirinix.LabelGUID: "x", "app": "other"}},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = client.ExtensionsV1beta1().Ingresses("eirini").Create(&v1beta1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "other"}})
+		Expect(err).ToNot(HaveOccurred())
+
+		changes, err = pw.Plan(client, "eirini")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary(changes)).To(Equal([]string{
+			"delete Service eirini/bar",
+			"delete Ingress eirini/bar",
+		}))
+		Expect(pw.Apply(client, changes)).To(BeEmpty())
+		_, err = client.CoreV1().Services("eirini").Get("bar", metav1.GetOptions{})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("adopts the unlabeled resources of the apps which are gone only if asked", func() {
+		_, err := client.CoreV1().Services("eirini").Create(&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "legacy"},
+			Spec:       corev1.ServiceSpec{Selector: map[string]string{eirinix.LabelGUID: "legacy-guid"}},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = client.ExtensionsV1beta1().Ingresses("eirini").Create(&v1beta1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: "legacy"},
+			Spec: v1beta1.IngressSpec{Rules: []v1beta1.IngressRule{{
+				Host: "legacy.example.com",
+				IngressRuleValue: v1beta1.IngressRuleValue{HTTP: &v1beta1.HTTPIngressRuleValue{
+					Paths: []v1beta1.HTTPIngressPath{{Backend: v1beta1.IngressBackend{ServiceName: "legacy"}}},
+				}},
+			}}},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		changes, err := pw.Plan(client, "eirini")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary(changes)).ToNot(ContainElement(ContainSubstring("legacy")))
+
+		pw.AdoptUnlabeled = true
+		changes, err = pw.Plan(client, "eirini")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary(changes)).To(ContainElement("delete Service eirini/legacy"))
+		Expect(summary(changes)).To(ContainElement("delete Ingress eirini/legacy"))
+	})
+
+	It("includes the instance services", func() {
+		pw.InstanceServices = true
+		changes, err := pw.Plan(client, "eirini")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary(changes)).To(ContainElement("create Service eirini/foo-instance-1"))
+		Expect(pw.Apply(client, changes)).To(BeEmpty())
+
+		Expect(client.CoreV1().Pods("eirini").Delete("foo-1", nil)).To(Succeed())
+		changes, err = pw.Plan(client, "eirini")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary(changes)).To(Equal([]string{"delete Service eirini/foo-instance-1"}))
+	})
+})
@@ -0,0 +1,290 @@
+package ingress
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	eirinix "github.com/SUSE/eirinix"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// AppInstanceHeader pins a request to an app instance, in the form `<app guid>:<instance index>`
+	AppInstanceHeader = "X-CF-APP-INSTANCE"
+
+	// proxyCertificateRefresh is how long the certificates of the TLS secrets are cached
+	proxyCertificateRefresh = time.Minute
+)
+
+// Proxy is a reverse proxy serving the Eirini apps of the RouteTable, without an ingress controller.
+// Requests are routed by their Host header to the ready instances of the app, balanced round-robin.
+// WebSocket upgrades are proxied, and the X-Forwarded-* headers are set.
+type Proxy struct {
+	Routes *RouteTable
+	// Client reads the TLS secrets, to select the certificate by SNI. It is set by ListenAndServe if nil.
+	Client kubernetes.Interface
+	// TLSSecrets maps domains to shared TLS secrets, as in EiriniApp
+	TLSSecrets map[string]string
+	// Transport is used to reach the app instances and route services, http.DefaultTransport if nil
+	Transport http.RoundTripper
+	// RouteServices signs the requests forwarded to the route services, requests for routes
+	// bound to a route service are rejected if nil
+	RouteServices *RouteServiceSigner
+
+	mu    sync.Mutex
+	next  map[string]int
+	certs map[string]cachedCertificate
+}
+
+type cachedCertificate struct {
+	certificate *tls.Certificate
+	loaded      time.Time
+}
+
+// NewProxy returns a Proxy for the route table
+func NewProxy(routes *RouteTable, tlsSecrets map[string]string) *Proxy {
+	return &Proxy{
+		Routes:     routes,
+		TLSSecrets: tlsSecrets,
+		next:       map[string]int{},
+		certs:      map[string]cachedCertificate{},
+	}
+}
+
+// matchRoute returns the app route serving the hostname
+func matchRoute(app AppRoutes, hostname string) (Route, bool) {
+	best, route := -1, Route{}
+	for _, r := range app.Routes {
+		if score, ok := matchDomain(strings.ToLower(r.Hostname), hostname); ok && score > best {
+			best, route = score, r
+		}
+	}
+	return route, best != -1
+}
+
+// lookup returns the app and the route serving the hostname
+func (p *Proxy) lookup(hostname string) (AppRoutes, Route, bool) {
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	app, ok := p.Routes.Lookup(hostname)
+	if !ok {
+		return app, Route{}, false
+	}
+	route, ok := matchRoute(app, hostname)
+	return app, route, ok
+}
+
+// balance returns the address of the next ready instance of the app, or an empty string if none is ready
+func (p *Proxy) balance(app AppRoutes, route Route) string {
+	ready := []string{}
+	for _, i := range sortedInstances(app) {
+		if i.Ready && i.IP != "" {
+			ready = append(ready, i.IP)
+		}
+	}
+	if len(ready) == 0 {
+		return ""
+	}
+
+	p.mu.Lock()
+	key := appKey(app.Namespace, app.Name)
+	n := p.next[key] % len(ready)
+	p.next[key] = n + 1
+	p.mu.Unlock()
+	return net.JoinHostPort(ready[n], strconv.Itoa(route.Port))
+}
+
+// Backend returns the route serving the hostname, and the address of its next ready instance
+func (p *Proxy) Backend(hostname string) (Route, string, bool) {
+	app, route, ok := p.lookup(hostname)
+	if !ok {
+		return route, "", false
+	}
+	return route, p.balance(app, route), true
+}
+
+// InstanceBackend returns the address of the app instance selected by the value of
+// the X-CF-APP-INSTANCE header, in the form `<app guid>:<instance index>`
+func (p *Proxy) InstanceBackend(hostname, instance string) (string, error) {
+	app, route, ok := p.lookup(hostname)
+	if !ok {
+		return "", fmt.Errorf("no app serves %s", hostname)
+	}
+	parts := strings.SplitN(instance, ":", 2)
+	if len(parts) != 2 || parts[0] != app.GUID {
+		return "", fmt.Errorf("invalid %s header: %s", AppInstanceHeader, instance)
+	}
+	for _, i := range app.Instances {
+		if i.InstanceID == parts[1] && i.Ready && i.IP != "" {
+			return net.JoinHostPort(i.IP, strconv.Itoa(route.Port)), nil
+		}
+	}
+	return "", fmt.Errorf("instance %s of %s is not ready", parts[1], app.Name)
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	app, route, ok := p.lookup(host)
+	if !ok {
+		http.Error(w, "no app serves "+host, http.StatusNotFound)
+		return
+	}
+
+	proto, port := "http", "80"
+	if r.TLS != nil {
+		proto, port = "https", "443"
+	}
+	if _, hostPort, err := net.SplitHostPort(r.Host); err == nil {
+		port = hostPort
+	}
+	forwarded := func(req *http.Request) {
+		// X-Forwarded-For is appended by the ReverseProxy
+		req.Header.Set("X-Forwarded-Host", r.Host)
+		req.Header.Set("X-Forwarded-Proto", proto)
+		req.Header.Set("X-Forwarded-Port", port)
+	}
+
+	// Requests for routes bound to a route service go through it first,
+	// unless they come back from it with a valid signature
+	if route.RouteServiceURL != "" {
+		if p.RouteServices == nil {
+			http.Error(w, "route services are not enabled", http.StatusBadGateway)
+			return
+		}
+		requestURL := proto + "://" + r.Host + r.URL.RequestURI()
+		signature := r.Header.Get(RouteServiceSignatureHeader)
+		if signature == "" {
+			p.forwardToRouteService(w, r, route.RouteServiceURL, requestURL, forwarded)
+			return
+		}
+		if err := p.RouteServices.Validate(signature, r.Header.Get(RouteServiceMetadataHeader), requestURL); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var backend string
+	if instance := r.Header.Get(AppInstanceHeader); instance != "" {
+		var err error
+		if backend, err = p.InstanceBackend(host, instance); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if backend = p.balance(app, route); backend == "" {
+		http.Error(w, "no ready instance serves "+host, http.StatusServiceUnavailable)
+		return
+	}
+	p.reverseProxy(func(req *http.Request) {
+		req.URL.Scheme = "http"
+		req.URL.Host = backend
+		forwarded(req)
+	}).ServeHTTP(w, r)
+}
+
+func (p *Proxy) forwardToRouteService(w http.ResponseWriter, r *http.Request, routeServiceURL, requestURL string, forwarded func(*http.Request)) {
+	target, err := url.Parse(routeServiceURL)
+	if err != nil {
+		http.Error(w, "invalid route service URL", http.StatusBadGateway)
+		return
+	}
+	signature, metadata, err := p.RouteServices.Sign(requestURL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	p.reverseProxy(func(req *http.Request) {
+		req.URL.Scheme = target.Scheme
+		req.URL.Host = target.Host
+		req.URL.Path = target.Path
+		req.URL.RawPath = target.RawPath
+		req.URL.RawQuery = target.RawQuery
+		req.Host = target.Host
+		req.Header.Set(RouteServiceForwardedURLHeader, requestURL)
+		req.Header.Set(RouteServiceSignatureHeader, signature)
+		req.Header.Set(RouteServiceMetadataHeader, metadata)
+		forwarded(req)
+	}).ServeHTTP(w, r)
+}
+
+func (p *Proxy) reverseProxy(director func(*http.Request)) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Director:  director,
+		Transport: p.Transport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		},
+	}
+}
+
+// GetCertificate returns the certificate of the TLS secret of the requested server name.
+// It is meant to be used as tls.Config.GetCertificate.
+func (p *Proxy) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	hostname := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	app, ok := p.Routes.Lookup(hostname)
+	if !ok {
+		return nil, errors.New("no app serves " + hostname)
+	}
+	eiriniApp := EiriniApp{Name: app.Name, Namespace: app.Namespace, TLSSecrets: p.TLSSecrets}
+	secret, ok := eiriniApp.SharedTLSSecret(hostname)
+	if !ok {
+		secret = eiriniApp.AppTLSSecret()
+	}
+
+	key := appKey(app.Namespace, secret)
+	p.mu.Lock()
+	cached, ok := p.certs[key]
+	p.mu.Unlock()
+	if ok && time.Since(cached.loaded) < proxyCertificateRefresh {
+		return cached.certificate, nil
+	}
+
+	s, err := p.Client.CoreV1().Secrets(app.Namespace).Get(secret, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	certificate, err := tls.X509KeyPair(s.Data[corev1.TLSCertKey], s.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.certs[key] = cachedCertificate{certificate: &certificate, loaded: time.Now()}
+	p.mu.Unlock()
+	return &certificate, nil
+}
+
+// ListenAndServe serves HTTP on addr and, if tlsAddr is not empty, HTTPS on tlsAddr.
+// It blocks until one of the servers fails.
+func (p *Proxy) ListenAndServe(manager eirinix.Manager, addr, tlsAddr string) error {
+	if p.Client == nil {
+		clientset, err := getClientSet(manager)
+		if err != nil {
+			return err
+		}
+		p.Client = clientset
+	}
+
+	errs := make(chan error, 2)
+	go func() { errs <- http.ListenAndServe(addr, p) }()
+	if tlsAddr != "" {
+		server := &http.Server{
+			Addr:      tlsAddr,
+			Handler:   p,
+			TLSConfig: &tls.Config{GetCertificate: p.GetCertificate},
+		}
+		go func() { errs <- server.ListenAndServeTLS("", "") }()
+	}
+	return <-errs
+}
@@ -0,0 +1,157 @@
+package ingress_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/mudler/eirini-ingress/extensions/ingress"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Proxy", func() {
+	var (
+		routes  *RouteTable
+		proxy   *Proxy
+		backend *httptest.Server
+		headers http.Header
+	)
+
+	BeforeEach(func() {
+		routes = NewRouteTable()
+		for _, pod := range []*corev1.Pod{
+			appPod("foo", "foo-guid", "0", `[{"hostname":"foo.example.com","port":8080}]`),
+			appPod("foo", "foo-guid", "1", `[{"hostname":"foo.example.com","port":8080}]`),
+			appPod("bar", "bar-guid", "0", `[{"hostname":"*.bar.example.com","port":9090}]`),
+		} {
+			routes.Update(NewEiriniApp(pod), pod, "svc", "ingress")
+		}
+
+		backend = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			headers = r.Header
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		proxy = NewProxy(routes, nil)
+		// Every instance is served by the test backend
+		proxy.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return net.Dial(network, backend.Listener.Addr().String())
+			},
+		}
+	})
+
+	AfterEach(func() {
+		backend.Close()
+	})
+
+	It("balances the ready instances round-robin", func() {
+		_, first, ok := proxy.Backend("foo.example.com")
+		Expect(ok).To(BeTrue())
+		_, second, _ := proxy.Backend("foo.example.com")
+		_, third, _ := proxy.Backend("FOO.example.com")
+		Expect([]string{first, second}).To(ConsistOf("10.1.0.0:8080", "10.1.0.1:8080"))
+		Expect(third).To(Equal(first))
+
+		_, addr, ok := proxy.Backend("x.bar.example.com")
+		Expect(ok).To(BeTrue())
+		Expect(addr).To(Equal("10.1.0.0:9090"))
+	})
+
+	It("skips the instances which are not ready", func() {
+		pod := appPod("foo", "foo-guid", "1", `[{"hostname":"foo.example.com","port":8080}]`)
+		pod.Status.Conditions[0].Status = corev1.ConditionFalse
+		routes.Update(NewEiriniApp(pod), pod, "svc", "ingress")
+		for i := 0; i < 3; i++ {
+			_, addr, _ := proxy.Backend("foo.example.com")
+			Expect(addr).To(Equal("10.1.0.0:8080"))
+		}
+	})
+
+	It("proxies by Host header with the X-Forwarded headers", func() {
+		req := httptest.NewRequest("GET", "http://foo.example.com:8000/path", nil)
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, req)
+		Expect(rec.Code).To(Equal(http.StatusNoContent))
+		Expect(headers.Get("X-Forwarded-Host")).To(Equal("foo.example.com:8000"))
+		Expect(headers.Get("X-Forwarded-Proto")).To(Equal("http"))
+		Expect(headers.Get("X-Forwarded-Port")).To(Equal("8000"))
+		Expect(headers.Get("X-Forwarded-For")).ToNot(BeEmpty())
+	})
+
+	It("pins the requests with the instance header to the instance", func() {
+		_, addr, _ := proxy.Backend("foo.example.com")
+		Expect(addr).To(Equal("10.1.0.0:8080"))
+		for i := 0; i < 2; i++ {
+			addr, err := proxy.InstanceBackend("foo.example.com", "foo-guid:0")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(addr).To(Equal("10.1.0.0:8080"))
+		}
+		_, err := proxy.InstanceBackend("foo.example.com", "bar-guid:0")
+		Expect(err).To(HaveOccurred())
+		_, err = proxy.InstanceBackend("foo.example.com", "foo-guid:5")
+		Expect(err).To(HaveOccurred())
+
+		req := httptest.NewRequest("GET", "http://foo.example.com/", nil)
+		req.Header.Set(AppInstanceHeader, "foo-guid:7")
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, req)
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+	})
+
+	Context("with a route service", func() {
+		BeforeEach(func() {
+			pod := appPod("rs", "rs-guid", "0", `[{"hostname":"rs.example.com","port":8080,"route_service_url":"http://auth.example.com/check"}]`)
+			routes.Update(NewEiriniApp(pod), pod, "svc", "ingress")
+		})
+
+		It("rejects the requests if route services are disabled", func() {
+			rec := httptest.NewRecorder()
+			proxy.ServeHTTP(rec, httptest.NewRequest("GET", "http://rs.example.com/", nil))
+			Expect(rec.Code).To(Equal(http.StatusBadGateway))
+		})
+
+		It("sends the requests through the route service, and the signed ones to the app", func() {
+			var err error
+			proxy.RouteServices, err = NewRouteServiceSigner("secret", time.Minute)
+			Expect(err).ToNot(HaveOccurred())
+
+			rec := httptest.NewRecorder()
+			proxy.ServeHTTP(rec, httptest.NewRequest("GET", "http://rs.example.com/path?q=1", nil))
+			Expect(rec.Code).To(Equal(http.StatusNoContent))
+			Expect(headers.Get(RouteServiceForwardedURLHeader)).To(Equal("http://rs.example.com/path?q=1"))
+			Expect(headers.Get(RouteServiceSignatureHeader)).ToNot(BeEmpty())
+			Expect(headers.Get(RouteServiceMetadataHeader)).ToNot(BeEmpty())
+
+			// The route service calls back the forwarded URL with the signature
+			req := httptest.NewRequest("GET", "http://rs.example.com/path?q=1", nil)
+			req.Header.Set(RouteServiceSignatureHeader, headers.Get(RouteServiceSignatureHeader))
+			req.Header.Set(RouteServiceMetadataHeader, headers.Get(RouteServiceMetadataHeader))
+			rec = httptest.NewRecorder()
+			proxy.ServeHTTP(rec, req)
+			Expect(rec.Code).To(Equal(http.StatusNoContent))
+			Expect(headers.Get(RouteServiceForwardedURLHeader)).To(BeEmpty())
+
+			req.Header.Set(RouteServiceSignatureHeader, "invalid")
+			rec = httptest.NewRecorder()
+			proxy.ServeHTTP(rec, req)
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	It("returns 404 for unknown hosts and 503 without ready instances", func() {
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, httptest.NewRequest("GET", "http://unknown.example.com/", nil))
+		Expect(rec.Code).To(Equal(http.StatusNotFound))
+
+		pod := appPod("baz", "baz-guid", "0", `[{"hostname":"baz.example.com","port":8080}]`)
+		pod.Status.Conditions = nil
+		routes.Update(NewEiriniApp(pod), pod, "svc", "ingress")
+		rec = httptest.NewRecorder()
+		proxy.ServeHTTP(rec, httptest.NewRequest("GET", "http://baz.example.com/", nil))
+		Expect(rec.Code).To(Equal(http.StatusServiceUnavailable))
+	})
+})
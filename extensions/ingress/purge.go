@@ -0,0 +1,94 @@
+package ingress
+
+import (
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ManagedResource is a resource created by the extension
+type ManagedResource struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+func (r ManagedResource) String() string {
+	return fmt.Sprintf("%s %s/%s", r.Kind, r.Namespace, r.Name)
+}
+
+// ManagedResources returns the resources created by the extension in the namespace, identified by
+// their labels: the Services and Ingresses, the secrets issued, synced from CredHub or replicated,
+// and the DNSEndpoints. Secrets created by older versions, without the ownership label, are left.
+// DNSEndpoints are skipped if dyn is nil or the CRD is not installed.
+func ManagedResources(client kubernetes.Interface, dyn dynamic.Interface, namespace string) ([]ManagedResource, error) {
+	resources := []ManagedResource{}
+	selector := labels.Set{ManagedByLabel: ManagedBy}.AsSelector().String()
+
+	services, err := client.CoreV1().Services(namespace).List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range services.Items {
+		resources = append(resources, ManagedResource{Kind: "Service", Namespace: namespace, Name: s.GetName()})
+	}
+
+	ingresses, err := client.ExtensionsV1beta1().Ingresses(namespace).List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	for _, in := range ingresses.Items {
+		resources = append(resources, ManagedResource{Kind: "Ingress", Namespace: namespace, Name: in.GetName()})
+	}
+
+	secrets, err := client.CoreV1().Secrets(namespace).List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	for _, secret := range secrets.Items {
+		resources = append(resources, ManagedResource{Kind: "Secret", Namespace: namespace, Name: secret.GetName()})
+	}
+
+	if dyn != nil {
+		set := labels.Set{DNSEndpointLabel: "true"}
+		endpoints, err := dyn.Resource(DNSEndpointResource).Namespace(namespace).List(metav1.ListOptions{LabelSelector: set.AsSelector().String()})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		if err == nil {
+			for _, e := range endpoints.Items {
+				resources = append(resources, ManagedResource{Kind: "DNSEndpoint", Namespace: namespace, Name: e.GetName()})
+			}
+		}
+	}
+	return resources, nil
+}
+
+// DeleteManagedResources deletes the resources, returning the ones which failed with their error.
+// Resources already gone are ignored.
+func DeleteManagedResources(client kubernetes.Interface, dyn dynamic.Interface, resources []ManagedResource) map[string]error {
+	failed := map[string]error{}
+	for _, r := range resources {
+		var err error
+		switch r.Kind {
+		case "Service":
+			err = client.CoreV1().Services(r.Namespace).Delete(r.Name, nil)
+		case "Ingress":
+			err = client.ExtensionsV1beta1().Ingresses(r.Namespace).Delete(r.Name, nil)
+		case "Secret":
+			err = client.CoreV1().Secrets(r.Namespace).Delete(r.Name, nil)
+		case "DNSEndpoint":
+			err = dyn.Resource(DNSEndpointResource).Namespace(r.Namespace).Delete(r.Name, &metav1.DeleteOptions{})
+		default:
+			err = fmt.Errorf("unknown kind %s", r.Kind)
+		}
+		if err != nil && !apierrors.IsNotFound(err) {
+			failed[r.String()] = err
+		}
+	}
+	return failed
+}
@@ -0,0 +1,89 @@
+package ingress_test
+
+import (
+	. "github.com/mudler/eirini-ingress/extensions/ingress"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Purge", func() {
+	var (
+		pw     *PodWatcher
+		client *fake.Clientset
+		dyn    *dynamicfake.FakeDynamicClient
+	)
+
+	secret := func(name string, labels map[string]string) *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "eirini", Name: name, Labels: labels}}
+	}
+
+	BeforeEach(func() {
+		pw = NewPodWatcher(nil, nil)
+		client = fake.NewSimpleClientset(
+			appPod("foo", "foo-guid", "0", `[{"hostname":"foo.example.com","port":8080}]`),
+			secret("bar-tls", map[string]string{IssuerLabel: CredHubIssuer, ManagedByLabel: ManagedBy}),
+			secret("eirini-ingress-ca", map[string]string{ManagedByLabel: ManagedBy}),
+			secret("foo-tls", map[string]string{IssuerLabel: SelfSignedIssuer, ManagedByLabel: ManagedBy}),
+			secret("wildcard-tls", map[string]string{ReplicaLabel: "true", ManagedByLabel: ManagedBy}),
+			secret("other", nil),
+			// Using the labels of the extension, without being created by it
+			secret("issued-elsewhere", map[string]string{IssuerLabel: "cert-manager"}),
+			secret("replicated-elsewhere", map[string]string{ReplicaLabel: "true"}),
+			&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "eirini", Name: "other"}},
+		)
+		changes, err := pw.Plan(client, "eirini")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pw.Apply(client, changes)).To(BeEmpty())
+
+		endpoint := &unstructured.Unstructured{}
+		endpoint.SetAPIVersion("externaldns.k8s.io/v1alpha1")
+		endpoint.SetKind("DNSEndpoint")
+		endpoint.SetNamespace("eirini")
+		endpoint.SetName("foo")
+		endpoint.SetLabels(map[string]string{DNSEndpointLabel: "true"})
+		dyn = dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), endpoint)
+	})
+
+	It("finds the resources created by the extension", func() {
+		resources, err := ManagedResources(client, dyn, "eirini")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resources).To(Equal([]ManagedResource{
+			{Kind: "Service", Namespace: "eirini", Name: "foo"},
+			{Kind: "Ingress", Namespace: "eirini", Name: "foo"},
+			{Kind: "Secret", Namespace: "eirini", Name: "bar-tls"},
+			{Kind: "Secret", Namespace: "eirini", Name: "eirini-ingress-ca"},
+			{Kind: "Secret", Namespace: "eirini", Name: "foo-tls"},
+			{Kind: "Secret", Namespace: "eirini", Name: "wildcard-tls"},
+			{Kind: "DNSEndpoint", Namespace: "eirini", Name: "foo"},
+		}))
+	})
+
+	It("deletes them, leaving the others", func() {
+		resources, err := ManagedResources(client, dyn, "eirini")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(DeleteManagedResources(client, dyn, resources)).To(BeEmpty())
+		Expect(DeleteManagedResources(client, dyn, resources)).To(BeEmpty())
+
+		resources, err = ManagedResources(client, dyn, "eirini")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resources).To(BeEmpty())
+		_, err = client.CoreV1().Services("eirini").Get("other", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		for _, name := range []string{"other", "issued-elsewhere", "replicated-elsewhere"} {
+			_, err = client.CoreV1().Secrets("eirini").Get(name, metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+		}
+	})
+
+	It("skips the DNSEndpoints without dynamic client", func() {
+		resources, err := ManagedResources(client, nil, "eirini")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resources).To(HaveLen(6))
+	})
+})
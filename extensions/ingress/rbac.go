@@ -0,0 +1,120 @@
+package ingress
+
+import (
+	"sort"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+// PolicyRules merges the permissions into the rules of a Role for each namespace, with a rule
+// for each resource. Namespaces, resources and verbs are sorted, for stable manifests.
+func PolicyRules(permissions []Permission) map[string][]rbacv1.PolicyRule {
+	type resource struct{ group, name string }
+	verbs := map[string]map[resource]map[string]interface{}{}
+	for _, p := range permissions {
+		if verbs[p.Namespace] == nil {
+			verbs[p.Namespace] = map[resource]map[string]interface{}{}
+		}
+		r := resource{group: p.Group, name: p.Resource}
+		if verbs[p.Namespace][r] == nil {
+			verbs[p.Namespace][r] = map[string]interface{}{}
+		}
+		for _, v := range p.Verbs {
+			verbs[p.Namespace][r][v] = nil
+		}
+	}
+
+	rules := map[string][]rbacv1.PolicyRule{}
+	for ns, resources := range verbs {
+		for r, set := range resources {
+			rule := rbacv1.PolicyRule{APIGroups: []string{r.group}, Resources: []string{r.name}}
+			for v := range set {
+				rule.Verbs = append(rule.Verbs, v)
+			}
+			sort.Strings(rule.Verbs)
+			rules[ns] = append(rules[ns], rule)
+		}
+		sort.Slice(rules[ns], func(i, j int) bool {
+			if rules[ns][i].APIGroups[0] != rules[ns][j].APIGroups[0] {
+				return rules[ns][i].APIGroups[0] < rules[ns][j].APIGroups[0]
+			}
+			return rules[ns][i].Resources[0] < rules[ns][j].Resources[0]
+		})
+	}
+	return rules
+}
+
+// Features are the features of the extension enabled in a namespace, deciding the permissions it needs
+type Features struct {
+	Namespace string
+	TLS       bool
+	// SelfSigned and CredHub are the issuers of the TLS certificates, used only with TLS
+	SelfSigned bool
+	CredHub    bool
+	// ReplicatedSecrets maps the replicas to their source secrets, as namespace/name
+	ReplicatedSecrets   map[string]string
+	MonitorCertificates bool
+	PropagateAddress    bool
+	ExternalDNS         string
+	// ProxyTLS is true if the reverse proxy serves HTTPS, reading the certificates of the apps
+	ProxyTLS bool
+}
+
+// RequiredPermissions returns the permissions needed by the enabled features
+func RequiredPermissions(f Features) []Permission {
+	ns := f.Namespace
+	events := false
+
+	permissions := []Permission{
+		{Namespace: ns, Resource: "pods", Verbs: []string{"get", "list", "watch"}, Reason: "watching the app pods"},
+		{Namespace: ns, Resource: "services", Verbs: []string{"get", "list", "create", "update", "delete"}, Reason: "generating the Services"},
+		{Namespace: ns, Group: "extensions", Resource: "ingresses", Verbs: []string{"get", "list", "create", "update", "delete"}, Reason: "generating the Ingresses"},
+	}
+	if f.TLS && f.SelfSigned {
+		permissions = append(permissions, Permission{Namespace: ns, Resource: "secrets", Verbs: []string{"get", "list", "create", "update", "delete"}, Reason: "issuing self-signed certificates"})
+	}
+	if f.TLS && f.CredHub {
+		permissions = append(permissions, Permission{Namespace: ns, Resource: "secrets", Verbs: []string{"get", "create", "update"}, Reason: "syncing the CredHub certificates"})
+	}
+	if f.TLS && len(f.ReplicatedSecrets) != 0 {
+		permissions = append(permissions, Permission{Namespace: ns, Resource: "secrets", Verbs: []string{"get", "list", "create", "update", "delete"}, Reason: "replicating the TLS secrets"})
+		sources := map[string]interface{}{}
+		for _, src := range f.ReplicatedSecrets {
+			if i := strings.Index(src, "/"); i > 0 {
+				sources[src[:i]] = nil
+			}
+		}
+		srcNamespaces := []string{}
+		for srcNamespace := range sources {
+			srcNamespaces = append(srcNamespaces, srcNamespace)
+		}
+		sort.Strings(srcNamespaces)
+		for _, srcNamespace := range srcNamespaces {
+			permissions = append(permissions, Permission{Namespace: srcNamespace, Resource: "secrets", Verbs: []string{"get"}, Reason: "reading the replicated TLS secrets"})
+		}
+	}
+	if f.TLS && f.MonitorCertificates {
+		events = true
+		permissions = append(permissions, Permission{Namespace: ns, Resource: "secrets", Verbs: []string{"get"}, Reason: "monitoring the certificates"})
+	}
+	if f.ProxyTLS {
+		permissions = append(permissions, Permission{Namespace: ns, Resource: "secrets", Verbs: []string{"get"}, Reason: "serving the apps over HTTPS with the reverse proxy"})
+	}
+	if f.PropagateAddress {
+		events = true
+		permissions = append(permissions,
+			Permission{Namespace: ns, Group: "extensions", Resource: "ingresses", Verbs: []string{"watch"}, Reason: "propagating the ingress address"},
+			Permission{Namespace: ns, Group: "apps", Resource: "statefulsets", Verbs: []string{"get", "patch"}, Reason: "propagating the ingress address"},
+			Permission{Namespace: ns, Resource: "pods", Verbs: []string{"patch"}, Reason: "propagating the ingress address"},
+		)
+	}
+	if events {
+		permissions = append(permissions, Permission{Namespace: ns, Resource: "events", Verbs: []string{"create", "patch"}, Reason: "emitting events on the apps"})
+	}
+	if f.ExternalDNS == ExternalDNSEndpoints {
+		permissions = append(permissions, Permission{Namespace: ns, Group: DNSEndpointResource.Group, Resource: DNSEndpointResource.Resource,
+			Verbs: []string{"get", "list", "create", "update", "delete"}, Reason: "publishing the DNSEndpoints"})
+	}
+	return permissions
+}
@@ -0,0 +1,73 @@
+package ingress_test
+
+import (
+	. "github.com/mudler/eirini-ingress/extensions/ingress"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+var _ = Describe("Policy rules", func() {
+	It("merges the permissions by namespace and resource", func() {
+		rules := PolicyRules([]Permission{
+			{Namespace: "eirini", Resource: "pods", Verbs: []string{"watch", "get"}},
+			{Namespace: "eirini", Group: "extensions", Resource: "ingresses", Verbs: []string{"get"}},
+			{Namespace: "eirini", Resource: "secrets", Verbs: []string{"get", "create"}},
+			{Namespace: "eirini", Resource: "pods", Verbs: []string{"patch", "get"}},
+			{Namespace: "platform", Resource: "secrets", Verbs: []string{"get"}},
+		})
+		Expect(rules).To(Equal(map[string][]rbacv1.PolicyRule{
+			"eirini": {
+				{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "patch", "watch"}},
+				{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"create", "get"}},
+				{APIGroups: []string{"extensions"}, Resources: []string{"ingresses"}, Verbs: []string{"get"}},
+			},
+			"platform": {
+				{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}},
+			},
+		}))
+	})
+
+	Describe("required permissions", func() {
+		secretsIn := func(permissions []Permission, namespace string) []string {
+			verbs := []string{}
+			for _, p := range permissions {
+				if p.Namespace == namespace && p.Resource == "secrets" {
+					verbs = append(verbs, p.Verbs...)
+				}
+			}
+			return verbs
+		}
+
+		It("only reads the pods and writes Services and Ingresses by default", func() {
+			rules := PolicyRules(RequiredPermissions(Features{Namespace: "eirini"}))
+			Expect(rules).To(Equal(map[string][]rbacv1.PolicyRule{
+				"eirini": {
+					{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list", "watch"}},
+					{APIGroups: []string{""}, Resources: []string{"services"}, Verbs: []string{"create", "delete", "get", "list", "update"}},
+					{APIGroups: []string{"extensions"}, Resources: []string{"ingresses"}, Verbs: []string{"create", "delete", "get", "list", "update"}},
+				},
+			}))
+		})
+
+		It("reads the secrets served by the reverse proxy over HTTPS", func() {
+			Expect(secretsIn(RequiredPermissions(Features{Namespace: "eirini"}), "eirini")).To(BeEmpty())
+			Expect(secretsIn(RequiredPermissions(Features{Namespace: "eirini", ProxyTLS: true}), "eirini")).To(Equal([]string{"get"}))
+		})
+
+		It("reads the sources of the replicated secrets in their namespace", func() {
+			permissions := RequiredPermissions(Features{
+				Namespace:         "eirini",
+				TLS:               true,
+				ReplicatedSecrets: map[string]string{"a-tls": "certs/a", "b-tls": "certs/b", "c-tls": "platform/c"},
+			})
+			Expect(secretsIn(permissions, "certs")).To(Equal([]string{"get"}))
+			Expect(secretsIn(permissions, "platform")).To(Equal([]string{"get"}))
+			Expect(secretsIn(permissions, "eirini")).To(ContainElement("create"))
+
+			// Secrets are replicated only with TLS
+			permissions = RequiredPermissions(Features{Namespace: "eirini", ReplicatedSecrets: map[string]string{"a-tls": "certs/a"}})
+			Expect(secretsIn(permissions, "certs")).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,71 @@
+package ingress
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Reconcile brings the namespace to the state the watcher keeps, in a single pass: the resources
+// of every app are ensured with EnsureApp, the Services and Ingresses of the apps which are gone
+// are deleted, and the instance Services, replicated secrets, certificates and DNSEndpoints left
+// without app are removed. It returns the changes planned for the Services and Ingresses, and the
+// steps which failed with their error. dyn is only used for the DNSEndpoints, and can be nil without them.
+func (pw *PodWatcher) Reconcile(client kubernetes.Interface, dyn dynamic.Interface, namespace string) ([]Change, map[string]error, error) {
+	changes, err := pw.Plan(client, namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+	pods, err := client.CoreV1().Pods(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	failed := map[string]error{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		app := pw.GetRouteHandler(pod)
+		if !app.Validate() {
+			continue
+		}
+		if err := pw.EnsureApp(client, dyn, pod, app); err != nil {
+			failed[fmt.Sprintf("ensure the app of pod %s/%s", namespace, pod.GetName())] = err
+		}
+	}
+
+	deletions := []Change{}
+	for _, c := range changes {
+		if c.Action == ActionDelete {
+			deletions = append(deletions, c)
+		}
+	}
+	for change, err := range pw.Apply(client, deletions) {
+		failed[change] = err
+	}
+
+	if pw.InstanceServices {
+		if err := pw.SyncInstanceServices(client, namespace); err != nil {
+			failed["sync instance services"] = err
+		}
+	}
+	if pw.Replicator != nil {
+		if err := pw.Replicator.Sync(client, namespace); err != nil {
+			failed["sync replicated secrets"] = err
+		}
+	}
+	if pw.CA != nil {
+		if err := pw.CA.Prune(client, namespace); err != nil {
+			failed["prune certificates"] = err
+		}
+	}
+	if pw.ExternalDNS != nil && pw.ExternalDNS.Mode == ExternalDNSEndpoints {
+		if dyn == nil {
+			failed["sync DNS endpoints"] = fmt.Errorf("no client to sync the DNSEndpoints")
+		} else if err := pw.ExternalDNS.Sync(client, dyn, namespace); err != nil {
+			failed["sync DNS endpoints"] = err
+		}
+	}
+	return changes, failed, nil
+}
@@ -0,0 +1,149 @@
+package ingress_test
+
+import (
+	eirinix "github.com/SUSE/eirinix"
+	. "github.com/mudler/eirini-ingress/extensions/ingress"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Reconcile", func() {
+	var (
+		pw     *PodWatcher
+		client *fake.Clientset
+		dyn    *dynamicfake.FakeDynamicClient
+	)
+
+	managed := metav1.ObjectMeta{Namespace: "eirini", Labels: map[string]string{ManagedByLabel: ManagedBy}}
+	meta := func(name string) metav1.ObjectMeta {
+		m := *managed.DeepCopy()
+		m.Name = name
+		return m
+	}
+
+	BeforeEach(func() {
+		pw = NewPodWatcher(nil, nil)
+		pw.TLS = true
+		pw.InstanceServices = true
+		pw.CA = NewSelfSignedCA("eirini", "eirini-ingress-ca")
+		pw.ExternalDNS = NewExternalDNS(ExternalDNSEndpoints, []string{"10.0.0.1"}, 0)
+
+		client = fake.NewSimpleClientset(
+			appPod("foo", "foo-guid", "0", `[{"hostname":"foo.example.com","port":8080}]`),
+			appPod("foo", "foo-guid", "1", `[{"hostname":"foo.example.com","port":8080}]`),
+			// Drifted from the desired state
+			&corev1.Service{
+				ObjectMeta: meta("foo"),
+				Spec: corev1.ServiceSpec{
+					Ports:    []corev1.ServicePort{{Port: 9090}},
+					Selector: map[string]string{eirinix.LabelGUID: "foo-guid"},
+				},
+			},
+			// Left behind by an app deleted while the watcher was not running
+			&corev1.Service{
+				ObjectMeta: meta("gone"),
+				Spec:       corev1.ServiceSpec{Selector: map[string]string{eirinix.LabelGUID: "gone-guid"}},
+			},
+			&v1beta1.Ingress{
+				ObjectMeta: meta("gone"),
+				Spec: v1beta1.IngressSpec{
+					Rules: []v1beta1.IngressRule{{Host: "gone.example.com"}},
+					TLS:   []v1beta1.IngressTLS{{Hosts: []string{"gone.example.com"}, SecretName: "gone-tls"}},
+				},
+			},
+			&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "eirini", Name: "gone-tls", Labels: map[string]string{IssuerLabel: SelfSignedIssuer}}},
+			&corev1.Service{ObjectMeta: metav1.ObjectMeta{
+				Namespace: "eirini",
+				Name:      "gone-instance-0",
+				Labels:    map[string]string{InstanceServiceLabel: "gone"},
+			}},
+			// Not created by the extension
+			&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "eirini", Name: "other"}},
+		)
+		dyn = dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+		Expect(NewExternalDNS(ExternalDNSEndpoints, []string{"10.0.0.1"}, 0).EnsureEndpoint(dyn, &v1beta1.Ingress{
+			ObjectMeta: meta("gone"),
+			Spec:       v1beta1.IngressSpec{Rules: []v1beta1.IngressRule{{Host: "gone.example.com"}}},
+		})).To(Succeed())
+	})
+
+	It("reconciles the namespace as the watcher does", func() {
+		changes, failed, err := pw.Reconcile(client, dyn, "eirini")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(failed).To(BeEmpty())
+		summary := []string{}
+		for _, c := range changes {
+			summary = append(summary, c.String())
+		}
+		Expect(summary).To(Equal([]string{
+			"update Service eirini/foo",
+			"create Service eirini/foo-instance-0",
+			"create Service eirini/foo-instance-1",
+			"delete Service eirini/gone",
+			"delete Service eirini/gone-instance-0",
+			"create Ingress eirini/foo",
+			"delete Ingress eirini/gone",
+		}))
+
+		// The drifted service is fixed
+		svc, err := client.CoreV1().Services("eirini").Get("foo", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(svc.Spec.Ports).To(HaveLen(1))
+		Expect(svc.Spec.Ports[0].Port).To(BeEquivalentTo(8080))
+
+		// The resources of the app are created beyond the Service and Ingress
+		_, err = client.CoreV1().Services("eirini").Get("foo-instance-1", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		secret, err := client.CoreV1().Secrets("eirini").Get("foo-tls", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(decodeCert(secret.Data[corev1.TLSCertKey]).DNSNames).To(Equal([]string{"foo.example.com"}))
+		_, err = dyn.Resource(DNSEndpointResource).Namespace("eirini").Get("foo", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		// The orphaned resources are removed
+		_, err = client.CoreV1().Services("eirini").Get("gone", metav1.GetOptions{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		_, err = client.ExtensionsV1beta1().Ingresses("eirini").Get("gone", metav1.GetOptions{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		_, err = client.CoreV1().Services("eirini").Get("gone-instance-0", metav1.GetOptions{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		_, err = client.CoreV1().Secrets("eirini").Get("gone-tls", metav1.GetOptions{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		_, err = dyn.Resource(DNSEndpointResource).Namespace("eirini").Get("gone", metav1.GetOptions{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+		// Everything else is left alone
+		_, err = client.CoreV1().Services("eirini").Get("other", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = client.CoreV1().Secrets("eirini").Get("eirini-ingress-ca", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		changes, err = pw.Plan(client, "eirini")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(changes).To(BeEmpty())
+	})
+
+	It("deletes the ingress of an app bound to route services only if generated", func() {
+		pw = NewPodWatcher(nil, nil)
+		pod := appPod("bar", "bar-guid", "0", `[{"hostname":"bar.example.com","port":8080,"route_service_url":"https://rs.example.com"}]`)
+		client = fake.NewSimpleClientset(pod, &v1beta1.Ingress{ObjectMeta: meta("bar")})
+		Expect(pw.EnsureApp(client, nil, pod, pw.GetRouteHandler(pod))).To(Succeed())
+		_, err := client.ExtensionsV1beta1().Ingresses("eirini").Get("bar", metav1.GetOptions{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+		// An ingress with the name of the app, not created by the extension
+		unlabeled := &v1beta1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "eirini", Name: "bar"}}
+		_, err = client.ExtensionsV1beta1().Ingresses("eirini").Create(unlabeled)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pw.EnsureApp(client, nil, pod, pw.GetRouteHandler(pod))).To(Succeed())
+		_, err = client.ExtensionsV1beta1().Ingresses("eirini").Get("bar", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+	})
+})
@@ -0,0 +1,163 @@
+package ingress
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	eirinix "github.com/SUSE/eirinix"
+	corev1 "k8s.io/api/core/v1"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// ReplicaLabel is the label set on the secrets copied by the SecretReplicator
+	ReplicaLabel = "eirinix.suse.org/ingress-replica"
+	// ReplicaOfAnnotation is the annotation containing the source of a replicated secret
+	ReplicaOfAnnotation = "eirinix.suse.org/ingress-replica-of"
+)
+
+// SecretReplicator copies TLS secrets from a central namespace into the namespaces
+// of the ingresses referencing them.
+type SecretReplicator struct {
+	// Sources maps the name of the secrets referenced by the ingresses to
+	// their source, in the `namespace/name` form
+	Sources map[string]string
+}
+
+// NewSecretReplicator returns a SecretReplicator for the given sources
+func NewSecretReplicator(sources map[string]string) *SecretReplicator {
+	return &SecretReplicator{Sources: sources}
+}
+
+func (r *SecretReplicator) source(name string) (string, string, bool) {
+	src, ok := r.Sources[name]
+	if !ok {
+		return "", "", false
+	}
+	parts := strings.SplitN(src, "/", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// Ensure copies the sources of the TLS secrets referenced by the ingress into its namespace
+func (r *SecretReplicator) Ensure(client kubernetes.Interface, in *v1beta1.Ingress) error {
+	for _, t := range in.Spec.TLS {
+		if err := r.replicate(client, in.GetNamespace(), t.SecretName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *SecretReplicator) replicate(client kubernetes.Interface, namespace, name string) error {
+	srcNamespace, srcName, ok := r.source(name)
+	if !ok || (srcNamespace == namespace && srcName == name) {
+		return nil
+	}
+
+	src, err := client.CoreV1().Secrets(srcNamespace).Get(srcName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("reading source secret %s/%s: %s", srcNamespace, srcName, err.Error())
+	}
+
+	replica, err := client.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = client.CoreV1().Secrets(namespace).Create(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   namespace,
+				Labels:      map[string]string{ReplicaLabel: "true", ManagedByLabel: ManagedBy},
+				Annotations: map[string]string{ReplicaOfAnnotation: r.Sources[name]},
+			},
+			Type: src.Type,
+			Data: src.Data,
+		})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	// Never overwrite secrets which were not created by us
+	if replica.GetLabels()[ReplicaLabel] != "true" {
+		return nil
+	}
+	if reflect.DeepEqual(replica.Data, src.Data) && replica.GetAnnotations()[ReplicaOfAnnotation] == r.Sources[name] {
+		return nil
+	}
+
+	replica.Data = src.Data
+	if replica.Annotations == nil {
+		replica.Annotations = map[string]string{}
+	}
+	replica.Annotations[ReplicaOfAnnotation] = r.Sources[name]
+	_, err = client.CoreV1().Secrets(namespace).Update(replica)
+	return err
+}
+
+// Sync updates the replicas in the namespace from their sources, and removes the ones
+// which are no longer referenced by any ingress
+func (r *SecretReplicator) Sync(client kubernetes.Interface, namespace string) error {
+	set := labels.Set{ReplicaLabel: "true"}
+	replicas, err := client.CoreV1().Secrets(namespace).List(metav1.ListOptions{LabelSelector: set.AsSelector().String()})
+	if err != nil {
+		return err
+	}
+	if len(replicas.Items) == 0 {
+		return nil
+	}
+
+	ingresses, err := client.ExtensionsV1beta1().Ingresses(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	referenced := map[string]interface{}{}
+	for _, in := range ingresses.Items {
+		for _, t := range in.Spec.TLS {
+			referenced[t.SecretName] = nil
+		}
+	}
+
+	for _, replica := range replicas.Items {
+		if _, ok := referenced[replica.GetName()]; ok {
+			if err := r.replicate(client, namespace, replica.GetName()); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := client.CoreV1().Secrets(namespace).Delete(replica.GetName(), nil); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		fmt.Println("Deleted replicated secret", replica.GetName())
+	}
+	return nil
+}
+
+// Run periodically syncs the replicas in the namespace until stop is closed
+func (r *SecretReplicator) Run(manager eirinix.Manager, namespace string, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		clientset, err := getClientSet(manager)
+		if err == nil {
+			err = r.Sync(clientset, namespace)
+		}
+		if err != nil {
+			manager.GetLogger().Error("Failed syncing replicated secrets: ", err.Error())
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
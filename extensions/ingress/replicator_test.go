@@ -0,0 +1,99 @@
+package ingress_test
+
+import (
+	. "github.com/mudler/eirini-ingress/extensions/ingress"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("SecretReplicator", func() {
+	var (
+		client     *fake.Clientset
+		replicator *SecretReplicator
+		in         *v1beta1.Ingress
+	)
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "wildcard", Namespace: "certs"},
+			Type:       corev1.SecretTypeTLS,
+			Data:       map[string][]byte{"tls.crt": []byte("cert-v1"), "tls.key": []byte("key")},
+		})
+		replicator = NewSecretReplicator(map[string]string{"wildcard-tls": "certs/wildcard"})
+		in = &v1beta1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "eirini"},
+			Spec: v1beta1.IngressSpec{
+				TLS: []v1beta1.IngressTLS{
+					{Hosts: []string{"foo.apps.example.com"}, SecretName: "wildcard-tls"},
+					{Hosts: []string{"foo.other.com"}, SecretName: "foo-tls"},
+				},
+			},
+		}
+	})
+
+	It("copies the source secrets into the namespace of the ingress", func() {
+		Expect(replicator.Ensure(client, in)).To(Succeed())
+
+		replica, err := client.CoreV1().Secrets("eirini").Get("wildcard-tls", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(replica.Type).To(Equal(corev1.SecretTypeTLS))
+		Expect(string(replica.Data["tls.crt"])).To(Equal("cert-v1"))
+		Expect(replica.Labels[ReplicaLabel]).To(Equal("true"))
+		Expect(replica.Labels[ManagedByLabel]).To(Equal(ManagedBy))
+		Expect(replica.Annotations[ReplicaOfAnnotation]).To(Equal("certs/wildcard"))
+
+		// Secrets without a source are left alone
+		_, err = client.CoreV1().Secrets("eirini").Get("foo-tls", metav1.GetOptions{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("updates the replicas when the source changes", func() {
+		Expect(replicator.Ensure(client, in)).To(Succeed())
+		_, err := client.ExtensionsV1beta1().Ingresses("eirini").Create(in)
+		Expect(err).ToNot(HaveOccurred())
+
+		src, err := client.CoreV1().Secrets("certs").Get("wildcard", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		src.Data["tls.crt"] = []byte("cert-v2")
+		_, err = client.CoreV1().Secrets("certs").Update(src)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(replicator.Sync(client, "eirini")).To(Succeed())
+		replica, err := client.CoreV1().Secrets("eirini").Get("wildcard-tls", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(replica.Data["tls.crt"])).To(Equal("cert-v2"))
+	})
+
+	It("removes the replicas no longer referenced by any ingress", func() {
+		Expect(replicator.Ensure(client, in)).To(Succeed())
+
+		Expect(replicator.Sync(client, "eirini")).To(Succeed())
+		_, err := client.CoreV1().Secrets("eirini").Get("wildcard-tls", metav1.GetOptions{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+		// The source is never touched
+		_, err = client.CoreV1().Secrets("certs").Get("wildcard", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("doesn't overwrite nor remove secrets it didn't create", func() {
+		_, err := client.CoreV1().Secrets("eirini").Create(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "wildcard-tls", Namespace: "eirini"},
+			Data:       map[string][]byte{"tls.crt": []byte("user-cert")},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(replicator.Ensure(client, in)).To(Succeed())
+		Expect(replicator.Sync(client, "eirini")).To(Succeed())
+
+		secret, err := client.CoreV1().Secrets("eirini").Get("wildcard-tls", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(secret.Data["tls.crt"])).To(Equal("user-cert"))
+		Expect(secret.Labels).ToNot(HaveKey(ReplicaLabel))
+	})
+})
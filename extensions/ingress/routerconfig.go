@@ -0,0 +1,308 @@
+package ingress
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	eirinix "github.com/SUSE/eirinix"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// RouterConfigNginx renders the routes as an nginx configuration
+	RouterConfigNginx = "nginx"
+	// RouterConfigHAProxy renders the routes as an HAProxy configuration
+	RouterConfigHAProxy = "haproxy"
+
+	// RouterBackendPods uses the IPs of the ready app instances as backends
+	RouterBackendPods = "pods"
+	// RouterBackendServices uses the ClusterIP of the app Service as backend
+	RouterBackendServices = "services"
+)
+
+var routerTemplates = map[string]*template.Template{
+	RouterConfigNginx: template.Must(template.New(RouterConfigNginx).Parse(`# Generated by eirini-ingress, do not edit
+{{- range .Upstreams}}
+
+upstream {{.Name}} {
+{{- range .Servers}}
+    server {{.}};
+{{- else}}
+    server 127.0.0.1:1 down;
+{{- end}}
+}
+{{- end}}
+{{- range .Hosts}}
+
+server {
+    listen {{$.ListenPort}};
+    server_name {{.Hostname}};
+
+    location / {
+        proxy_pass http://{{.Upstream}};
+        proxy_http_version 1.1;
+        proxy_set_header Host $host;
+        proxy_set_header Upgrade $http_upgrade;
+        proxy_set_header Connection $http_connection;
+        proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+        proxy_set_header X-Forwarded-Proto $scheme;
+    }
+}
+{{- end}}
+`)),
+	RouterConfigHAProxy: template.Must(template.New(RouterConfigHAProxy).Parse(`# Generated by eirini-ingress, do not edit
+
+frontend eirini
+    bind *:{{.ListenPort}}
+    mode http
+    option forwardfor
+{{- range .Hosts}}
+{{- if .Wildcard}}
+    use_backend {{.Upstream}} if { req.hdr(host),field(1,:) -m end -i {{slice .Hostname 1}} }
+{{- else}}
+    use_backend {{.Upstream}} if { req.hdr(host),field(1,:) -m str -i {{.Hostname}} }
+{{- end}}
+{{- end}}
+{{- range .Upstreams}}
+
+backend {{.Name}}
+    mode http
+    balance roundrobin
+{{- range $i, $server := .Servers}}
+    server s{{$i}} {{$server}} check
+{{- end}}
+{{- end}}
+`)),
+}
+
+// RouterUpstream is a group of backends serving an app port
+type RouterUpstream struct {
+	Name    string
+	Servers []string
+}
+
+// RouterHost is a hostname routed to an upstream
+type RouterHost struct {
+	Hostname string
+	Wildcard bool
+	Upstream string
+}
+
+// RouterConfig renders the RouteTable into configuration files for routers living outside
+// Kubernetes, from built-in nginx or HAProxy templates.
+type RouterConfig struct {
+	Routes *RouteTable
+	// Format is either RouterConfigNginx or RouterConfigHAProxy
+	Format string
+	// Backends is either RouterBackendPods or RouterBackendServices
+	Backends string
+	// Dir is the directory the configuration is written to
+	Dir string
+	// ReloadCommand is run with `sh -c` when the configuration changes, if set
+	ReloadCommand string
+	// ListenPort is the port the router listens on
+	ListenPort int
+	// Client reads the Service ClusterIPs. It is set by Run if nil.
+	Client kubernetes.Interface
+}
+
+// NewRouterConfig returns a RouterConfig writing the route table to dir in the given format
+func NewRouterConfig(routes *RouteTable, format, backends, dir string) *RouterConfig {
+	return &RouterConfig{Routes: routes, Format: format, Backends: backends, Dir: dir, ListenPort: 80}
+}
+
+var invalidUpstreamChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// upstreamName returns a name of the app port usable in both nginx and HAProxy
+func upstreamName(namespace, app string, port int) string {
+	return invalidUpstreamChars.ReplaceAllString(fmt.Sprintf("%s_%s_%d", namespace, app, port), "_")
+}
+
+// Path returns the path of the configuration file
+func (c *RouterConfig) Path() string {
+	if c.Format == RouterConfigHAProxy {
+		return filepath.Join(c.Dir, "eirini.cfg")
+	}
+	return filepath.Join(c.Dir, "eirini.conf")
+}
+
+// Render returns the configuration of the current route table. Apps whose Service is missing get
+// an upstream without servers. Upstreams whose servers can't be read are left out with their
+// hostnames, and returned as error along with the configuration of the other apps.
+func (c *RouterConfig) Render() ([]byte, error) {
+	tmpl, ok := routerTemplates[c.Format]
+	if !ok {
+		return nil, fmt.Errorf("invalid router configuration format: %s", c.Format)
+	}
+
+	upstreams := []RouterUpstream{}
+	hosts := []RouterHost{}
+	errs := []error{}
+	apps := c.Routes.Apps()
+	owners := hostnameOwners(apps)
+	for _, app := range apps {
+		// added tells if the upstream of the port was rendered
+		added := map[int]bool{}
+		for _, r := range app.Routes {
+			// Routers can't enforce route services, the routes bound to one are not served
+			if r.RouteServiceURL != "" {
+				continue
+			}
+			name := upstreamName(app.Namespace, app.Name, r.Port)
+			if _, ok := added[r.Port]; !ok {
+				servers, err := c.servers(app, r.Port)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("upstream %s left out: %s", name, err.Error()))
+				} else {
+					upstreams = append(upstreams, RouterUpstream{Name: name, Servers: servers})
+				}
+				added[r.Port] = err == nil
+			}
+			if !added[r.Port] {
+				continue
+			}
+
+			// Only the app serving a hostname gets it, once
+			hostname := strings.ToLower(r.Hostname)
+			if owners[hostname] != appKey(app.Namespace, app.Name) {
+				continue
+			}
+			owners[hostname] = ""
+			hosts = append(hosts, RouterHost{Hostname: hostname, Wildcard: strings.HasPrefix(hostname, "*."), Upstream: name})
+		}
+	}
+	// Exact hostnames take precedence over wildcards in first-match routers
+	sort.SliceStable(hosts, func(i, j int) bool { return !hosts[i].Wildcard && hosts[j].Wildcard })
+
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, struct {
+		ListenPort int
+		Upstreams  []RouterUpstream
+		Hosts      []RouterHost
+	}{c.ListenPort, upstreams, hosts})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), utilerrors.NewAggregate(errs)
+}
+
+func (c *RouterConfig) servers(app AppRoutes, port int) ([]string, error) {
+	servers := []string{}
+	if c.Backends == RouterBackendServices {
+		if c.Client == nil {
+			return nil, fmt.Errorf("no client to read the service %s", app.Service)
+		}
+		svc, err := c.Client.CoreV1().Services(app.Namespace).Get(app.Service, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			// Not created yet, the routes are served once it is
+			return servers, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ip := svc.Spec.ClusterIP; ip != "" && ip != "None" {
+			servers = append(servers, net.JoinHostPort(ip, strconv.Itoa(port)))
+		}
+		return servers, nil
+	}
+
+	for _, i := range sortedInstances(app) {
+		if i.Ready && i.IP != "" {
+			servers = append(servers, net.JoinHostPort(i.IP, strconv.Itoa(port)))
+		}
+	}
+	return servers, nil
+}
+
+// Write renders the configuration and replaces the file atomically if it changed, running
+// the reload command afterwards. It returns true if the configuration changed. The upstreams
+// left out of the configuration are returned as error, after writing it.
+func (c *RouterConfig) Write() (bool, error) {
+	data, renderErr := c.Render()
+	if data == nil {
+		return false, renderErr
+	}
+	if current, err := ioutil.ReadFile(c.Path()); err == nil && bytes.Equal(current, data) {
+		return false, renderErr
+	}
+
+	tmp, err := ioutil.TempFile(c.Dir, ".eirini-")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return false, err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return false, err
+	}
+	if err := os.Rename(tmp.Name(), c.Path()); err != nil {
+		return false, err
+	}
+
+	if c.ReloadCommand != "" {
+		if out, err := exec.Command("sh", "-c", c.ReloadCommand).CombinedOutput(); err != nil {
+			return true, fmt.Errorf("reload command failed: %s: %s", err.Error(), strings.TrimSpace(string(out)))
+		}
+	}
+	return true, renderErr
+}
+
+// Run writes the configuration on every change of the route table, and every interval to pick up
+// Service changes, until stop is closed
+func (c *RouterConfig) Run(manager eirinix.Manager, interval time.Duration, stop <-chan struct{}) {
+	if c.Client == nil {
+		clientset, err := getClientSet(manager)
+		if err != nil {
+			manager.GetLogger().Error(err.Error())
+			return
+		}
+		c.Client = clientset
+	}
+	events, cancel := c.Routes.Subscribe()
+	defer cancel()
+
+	write := func() {
+		// The configuration may be written without some upstreams, reported as error
+		changed, err := c.Write()
+		if err != nil {
+			manager.GetLogger().Error(err.Error())
+		}
+		if changed {
+			manager.GetLogger().Info("Router configuration written to ", c.Path())
+		}
+	}
+	write()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			write()
+		case <-events:
+			write()
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package ingress_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/mudler/eirini-ingress/extensions/ingress"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var _ = Describe("Router configuration", func() {
+	var (
+		routes *RouteTable
+		dir    string
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "routerconfig")
+		Expect(err).ToNot(HaveOccurred())
+
+		routes = NewRouteTable()
+		for _, pod := range []*corev1.Pod{
+			appPod("foo", "foo-guid", "0", `[{"hostname":"foo.example.com","port":8080}]`),
+			appPod("foo", "foo-guid", "1", `[{"hostname":"foo.example.com","port":8080}]`),
+			appPod("bar", "bar-guid", "2", `[{"hostname":"*.bar.example.com","port":9090}]`),
+			appPod("rs", "rs-guid", "3", `[{"hostname":"rs.example.com","port":8080,"route_service_url":"https://auth.example.com"}]`),
+		} {
+			routes.Update(NewEiriniApp(pod), pod, pod.Annotations[AppNameAnnotation], pod.Annotations[AppNameAnnotation])
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("renders nginx upstreams with the ready pod IPs", func() {
+		config := NewRouterConfig(routes, RouterConfigNginx, RouterBackendPods, dir)
+		data, err := config.Render()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring("upstream eirini_foo_8080 {\n    server 10.1.0.0:8080;\n    server 10.1.0.1:8080;\n}"))
+		Expect(string(data)).To(ContainSubstring("server_name *.bar.example.com;"))
+		Expect(string(data)).To(ContainSubstring("proxy_pass http://eirini_bar_9090;"))
+		// Route services can't be enforced by the router
+		Expect(string(data)).ToNot(ContainSubstring("rs.example.com"))
+	})
+
+	It("renders HAProxy backends with the Service ClusterIPs", func() {
+		config := NewRouterConfig(routes, RouterConfigHAProxy, RouterBackendServices, dir)
+		config.Client = fake.NewSimpleClientset(
+			&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "eirini", Name: "foo"}, Spec: corev1.ServiceSpec{ClusterIP: "10.0.0.1"}},
+			&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "eirini", Name: "bar"}, Spec: corev1.ServiceSpec{ClusterIP: "10.0.0.2"}},
+		)
+		data, err := config.Render()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring("use_backend eirini_foo_8080 if { req.hdr(host),field(1,:) -m str -i foo.example.com }"))
+		Expect(string(data)).To(ContainSubstring("use_backend eirini_bar_9090 if { req.hdr(host),field(1,:) -m end -i .bar.example.com }"))
+		Expect(string(data)).To(ContainSubstring("backend eirini_foo_8080\n    mode http\n    balance roundrobin\n    server s0 10.0.0.1:8080 check"))
+	})
+
+	It("renders the apps without Service, and leaves out the ones which can't be read", func() {
+		client := fake.NewSimpleClientset(
+			&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "eirini", Name: "foo"}, Spec: corev1.ServiceSpec{ClusterIP: "10.0.0.1"}},
+		)
+		config := NewRouterConfig(routes, RouterConfigNginx, RouterBackendServices, dir)
+		config.Client = client
+
+		// bar has no Service yet
+		data, err := config.Render()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring("upstream eirini_foo_8080 {\n    server 10.0.0.1:8080;\n}"))
+		Expect(string(data)).To(ContainSubstring("upstream eirini_bar_9090 {\n    server 127.0.0.1:1 down;\n}"))
+		Expect(string(data)).To(ContainSubstring("server_name *.bar.example.com;"))
+
+		client.PrependReactor("get", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if action.(k8stesting.GetAction).GetName() == "bar" {
+				return true, nil, errors.New("connection refused")
+			}
+			return false, nil, nil
+		})
+		changed, err := config.Write()
+		Expect(err).To(MatchError("upstream eirini_bar_9090 left out: connection refused"))
+		Expect(changed).To(BeTrue())
+		data, err = ioutil.ReadFile(config.Path())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring("server_name foo.example.com;"))
+		Expect(string(data)).ToNot(ContainSubstring("bar.example.com"))
+		Expect(string(data)).ToNot(ContainSubstring("eirini_bar_9090"))
+	})
+
+	It("writes the file and reloads only on changes", func() {
+		marker := filepath.Join(dir, "reloads")
+		config := NewRouterConfig(routes, RouterConfigNginx, RouterBackendPods, dir)
+		config.ReloadCommand = "echo reload >> " + marker
+
+		changed, err := config.Write()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(changed).To(BeTrue())
+		changed, err = config.Write()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(changed).To(BeFalse())
+
+		pod := appPod("foo", "foo-guid", "1", `[{"hostname":"foo.example.com","port":8080}]`)
+		routes.Delete(NewEiriniApp(pod), pod)
+		changed, err = config.Write()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(changed).To(BeTrue())
+
+		reloads, err := ioutil.ReadFile(marker)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(reloads)).To(Equal("reload\nreload\n"))
+		data, err := ioutil.ReadFile(config.Path())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).ToNot(ContainSubstring("10.1.0.1"))
+
+		files, err := ioutil.ReadDir(dir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(files).To(HaveLen(2))
+	})
+})
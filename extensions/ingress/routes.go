@@ -0,0 +1,460 @@
+package ingress
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// AppInstance is a running instance of an Eirini app
+type AppInstance struct {
+	PodName    string `json:"pod_name"`
+	InstanceID string `json:"instance_id"`
+	IP         string `json:"ip"`
+	Ready      bool   `json:"ready"`
+}
+
+// AppRoutes is the routing state of an Eirini app
+type AppRoutes struct {
+	Name      string                  `json:"name"`
+	GUID      string                  `json:"guid"`
+	Namespace string                  `json:"namespace"`
+	Service   string                  `json:"service"`
+	Ingress   string                  `json:"ingress"`
+	Routes    []Route                 `json:"routes"`
+	Instances map[string]*AppInstance `json:"instances"`
+}
+
+// RouteEntry is a route served by an Eirini app
+type RouteEntry struct {
+	Hostname  string `json:"hostname"`
+	Port      int    `json:"port"`
+	App       string `json:"app"`
+	GUID      string `json:"guid"`
+	Namespace string `json:"namespace"`
+	Instances int    `json:"instances"`
+	Ready     int    `json:"ready_instances"`
+	Service   string `json:"service"`
+	Ingress   string `json:"ingress"`
+	// RouteServiceURL is the URL of the route service bound to the route, if any
+	RouteServiceURL string `json:"route_service_url,omitempty"`
+}
+
+const (
+	// RouteAdded is the type of the events for new routes
+	RouteAdded = "added"
+	// RouteUpdated is the type of the events for routes whose app changed
+	RouteUpdated = "updated"
+	// RouteRemoved is the type of the events for removed routes
+	RouteRemoved = "removed"
+)
+
+// RouteEvent is a change in the RouteTable
+type RouteEvent struct {
+	Type  string     `json:"type"`
+	Route RouteEntry `json:"route"`
+}
+
+// RouteTable is the live table of the routes served by the Eirini apps, kept from the pod events.
+// It is safe for concurrent use.
+type RouteTable struct {
+	mu sync.RWMutex
+	// apps by namespace/name
+	apps        map[string]*AppRoutes
+	subscribers map[chan RouteEvent]interface{}
+	// reported are the apps claiming each conflicting hostname, as last returned by ChangedConflicts
+	reported map[string]string
+}
+
+// NewRouteTable returns an empty RouteTable
+func NewRouteTable() *RouteTable {
+	return &RouteTable{apps: map[string]*AppRoutes{}, subscribers: map[chan RouteEvent]interface{}{}}
+}
+
+// Subscribe returns a channel receiving the changes of the table, and a function to cancel
+// the subscription. Events are dropped if the subscriber doesn't keep up.
+func (t *RouteTable) Subscribe() (<-chan RouteEvent, func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ch := make(chan RouteEvent, 128)
+	t.subscribers[ch] = nil
+	return ch, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if _, ok := t.subscribers[ch]; ok {
+			delete(t.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// notify sends the differences between the routes of an app before and after a change.
+// All the routes are updated if the addresses of the instances changed, even if the
+// entries didn't. It must be called with the lock held.
+func (t *RouteTable) notify(before, after []RouteEntry, addressesChanged bool) {
+	if len(t.subscribers) == 0 {
+		return
+	}
+	key := func(r RouteEntry) string { return fmt.Sprintf("%s:%d", r.Hostname, r.Port) }
+	old := map[string]RouteEntry{}
+	for _, r := range before {
+		old[key(r)] = r
+	}
+
+	events := []RouteEvent{}
+	for _, r := range after {
+		prev, ok := old[key(r)]
+		delete(old, key(r))
+		switch {
+		case !ok:
+			events = append(events, RouteEvent{Type: RouteAdded, Route: r})
+		case prev != r || addressesChanged:
+			events = append(events, RouteEvent{Type: RouteUpdated, Route: r})
+		}
+	}
+	for _, r := range before {
+		if _, ok := old[key(r)]; ok {
+			events = append(events, RouteEvent{Type: RouteRemoved, Route: r})
+		}
+	}
+
+	for ch := range t.subscribers {
+		for _, e := range events {
+			select {
+			case ch <- e:
+			default:
+			}
+		}
+	}
+}
+
+// Entries returns the routes of the app, one for each hostname and port
+func (a *AppRoutes) Entries() []RouteEntry {
+	entries := []RouteEntry{}
+	if a == nil {
+		return entries
+	}
+	ready := 0
+	for _, i := range a.Instances {
+		if i.Ready {
+			ready++
+		}
+	}
+	for _, r := range a.Routes {
+		entries = append(entries, RouteEntry{
+			Hostname:  r.Hostname,
+			Port:      r.Port,
+			App:       a.Name,
+			GUID:      a.GUID,
+			Namespace: a.Namespace,
+			Instances: len(a.Instances),
+			Ready:     ready,
+			Service:   a.Service,
+			Ingress:   a.Ingress,
+
+			RouteServiceURL: r.RouteServiceURL,
+		})
+	}
+	return entries
+}
+
+// readyAddresses returns the IPs of the ready instances of the app, sorted
+func (a *AppRoutes) readyAddresses() string {
+	addresses := []string{}
+	for _, i := range a.Instances {
+		if i.Ready {
+			addresses = append(addresses, i.IP)
+		}
+	}
+	sort.Strings(addresses)
+	return strings.Join(addresses, ",")
+}
+
+// Routes returns all the routes in the table, sorted by hostname and port
+func (t *RouteTable) Routes() []RouteEntry {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	entries := []RouteEntry{}
+	for _, a := range t.apps {
+		entries = append(entries, a.Entries()...)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Hostname != entries[j].Hostname {
+			return entries[i].Hostname < entries[j].Hostname
+		}
+		return entries[i].Port < entries[j].Port
+	})
+	return entries
+}
+
+func appKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// Update records the pod of the app, with the service and ingress generated for it
+func (t *RouteTable) Update(app EiriniApp, pod *corev1.Pod, service, ingress string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := appKey(app.Namespace, app.Name)
+	current, ok := t.apps[key]
+	if !ok {
+		current = &AppRoutes{Instances: map[string]*AppInstance{}}
+		t.apps[key] = current
+	}
+	before := []RouteEntry{}
+	if ok {
+		before = current.Entries()
+	}
+	addresses := current.readyAddresses()
+	defer func() { t.notify(before, current.Entries(), addresses != current.readyAddresses()) }()
+	current.Name = app.Name
+	current.GUID = app.GUID
+	current.Namespace = app.Namespace
+	current.Service = service
+	current.Ingress = ingress
+	current.Routes = app.Routes
+	current.Instances[pod.GetName()] = &AppInstance{
+		PodName:    pod.GetName(),
+		InstanceID: app.InstanceID,
+		IP:         pod.Status.PodIP,
+		Ready:      podReady(pod),
+	}
+}
+
+// DeletePod removes the pod from the app it was recorded for, e.g. once it is no longer a valid
+// app. The app is removed once it has no instances left.
+func (t *RouteTable) DeletePod(pod *corev1.Pod) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key, current := range t.apps {
+		if _, ok := current.Instances[pod.GetName()]; !ok || current.Namespace != pod.GetNamespace() {
+			continue
+		}
+		before := current.Entries()
+		delete(current.Instances, pod.GetName())
+		if len(current.Instances) == 0 {
+			delete(t.apps, key)
+			t.notify(before, nil, false)
+			return
+		}
+		t.notify(before, current.Entries(), false)
+		return
+	}
+}
+
+// Delete removes the pod of the app. The app is removed once it has no instances left.
+func (t *RouteTable) Delete(app EiriniApp, pod *corev1.Pod) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := appKey(app.Namespace, app.Name)
+	current, ok := t.apps[key]
+	if !ok {
+		return
+	}
+	before := current.Entries()
+	delete(current.Instances, pod.GetName())
+	if len(current.Instances) == 0 {
+		delete(t.apps, key)
+		t.notify(before, nil, false)
+		return
+	}
+	t.notify(before, current.Entries(), false)
+}
+
+// Apps returns a copy of the routing state of all the apps, sorted by namespace and name
+func (t *RouteTable) Apps() []AppRoutes {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	apps := []AppRoutes{}
+	for _, a := range t.apps {
+		apps = append(apps, a.copy())
+	}
+	sort.Slice(apps, func(i, j int) bool {
+		return appKey(apps[i].Namespace, apps[i].Name) < appKey(apps[j].Namespace, apps[j].Name)
+	})
+	return apps
+}
+
+// claimsBefore returns true if the app a gets a hostname claimed by both a and b. The app with
+// the lowest GUID wins, so that the winner doesn't depend on the order of the pod events.
+func claimsBefore(a, b *AppRoutes) bool {
+	if a.GUID != b.GUID {
+		return a.GUID < b.GUID
+	}
+	return appKey(a.Namespace, a.Name) < appKey(b.Namespace, b.Name)
+}
+
+// hostnameOwners returns the key of the app serving each of the route hostnames, lowercased
+func hostnameOwners(apps []AppRoutes) map[string]string {
+	owners := map[string]*AppRoutes{}
+	for i := range apps {
+		for _, r := range apps[i].Routes {
+			hostname := strings.ToLower(r.Hostname)
+			if owner, ok := owners[hostname]; !ok || claimsBefore(&apps[i], owner) {
+				owners[hostname] = &apps[i]
+			}
+		}
+	}
+	keys := map[string]string{}
+	for hostname, a := range owners {
+		keys[hostname] = appKey(a.Namespace, a.Name)
+	}
+	return keys
+}
+
+// Lookup returns the app serving the hostname. Wildcard routes (e.g. `*.example.com`)
+// are matched if there is no app serving the exact hostname. If several apps claim the
+// hostname the one with the lowest GUID serves it, see Conflicts.
+func (t *RouteTable) Lookup(hostname string) (AppRoutes, bool) {
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	candidates := []string{hostname}
+	if i := strings.Index(hostname, "."); i != -1 {
+		candidates = append(candidates, "*"+hostname[i:])
+	}
+	for _, c := range candidates {
+		var owner *AppRoutes
+		for _, a := range t.apps {
+			for _, r := range a.Routes {
+				if strings.ToLower(r.Hostname) == c && (owner == nil || claimsBefore(a, owner)) {
+					owner = a
+				}
+			}
+		}
+		if owner != nil {
+			return owner.copy(), true
+		}
+	}
+	return AppRoutes{}, false
+}
+
+// RouteConflict is a hostname claimed by more than one app
+type RouteConflict struct {
+	Hostname string `json:"hostname"`
+	// Apps are the apps claiming the hostname in the namespace/name form,
+	// the first one is serving it
+	Apps []string `json:"apps"`
+}
+
+// Conflicts returns the hostnames claimed by more than one app, sorted by hostname
+func (t *RouteTable) Conflicts() []RouteConflict {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.conflicts()
+}
+
+// ChangedConflicts returns the conflicts which appeared, or whose apps changed, since the last call
+func (t *RouteTable) ChangedConflicts() []RouteConflict {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	changed := []RouteConflict{}
+	reported := map[string]string{}
+	for _, c := range t.conflicts() {
+		apps := strings.Join(c.Apps, ",")
+		if t.reported[c.Hostname] != apps {
+			changed = append(changed, c)
+		}
+		reported[c.Hostname] = apps
+	}
+	t.reported = reported
+	return changed
+}
+
+// conflicts returns the hostnames claimed by more than one app. It must be called with the lock held.
+func (t *RouteTable) conflicts() []RouteConflict {
+	claims := map[string][]*AppRoutes{}
+	for _, a := range t.apps {
+		seen := map[string]interface{}{}
+		for _, r := range a.Routes {
+			hostname := strings.ToLower(r.Hostname)
+			if _, ok := seen[hostname]; ok {
+				continue
+			}
+			seen[hostname] = nil
+			claims[hostname] = append(claims[hostname], a)
+		}
+	}
+
+	conflicts := []RouteConflict{}
+	for hostname, apps := range claims {
+		if len(apps) < 2 {
+			continue
+		}
+		sort.Slice(apps, func(i, j int) bool { return claimsBefore(apps[i], apps[j]) })
+		conflict := RouteConflict{Hostname: hostname}
+		for _, a := range apps {
+			conflict.Apps = append(conflict.Apps, appKey(a.Namespace, a.Name))
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].Hostname < conflicts[j].Hostname })
+	return conflicts
+}
+
+// LoadRoutes fills the route table with the pods already running, as the watcher
+// receives only the events happening after its start.
+func (pw *PodWatcher) LoadRoutes(pods []corev1.Pod) {
+	for i := range pods {
+		app := pw.GetRouteHandler(&pods[i])
+		if !app.Validate() {
+			continue
+		}
+		pw.updateRoutes(&pods[i], app, watch.Added)
+	}
+}
+
+func (pw *PodWatcher) updateRoutes(pod *corev1.Pod, app RouteHandler, event watch.EventType) {
+	eiriniApp := NewEiriniApp(pod)
+	eiriniApp.SetRouteServices(pw.RouteServices)
+	if event == watch.Deleted {
+		pw.Routes.Delete(eiriniApp, pod)
+		return
+	}
+	pw.Routes.Update(eiriniApp, pod, pw.DesiredService(app).GetName(), pw.DesiredIngress(app).GetName())
+}
+
+func (a *AppRoutes) copy() AppRoutes {
+	res := *a
+	res.Routes = append([]Route{}, a.Routes...)
+	res.Instances = map[string]*AppInstance{}
+	for k, v := range a.Instances {
+		i := *v
+		res.Instances[k] = &i
+	}
+	return res
+}
+
+// sortedInstances returns the instances of the app sorted by pod name
+func sortedInstances(app AppRoutes) []*AppInstance {
+	instances := []*AppInstance{}
+	for _, i := range app.Instances {
+		instances = append(instances, i)
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].PodName < instances[j].PodName })
+	return instances
+}
+
+func podReady(pod *corev1.Pod) bool {
+	if pod.GetDeletionTimestamp() != nil {
+		return false
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package ingress
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+)
+
+const (
+	// RouteServiceForwardedURLHeader is the header containing the URL originally requested,
+	// which the route service calls back
+	RouteServiceForwardedURLHeader = "X-CF-Forwarded-Url"
+	// RouteServiceSignatureHeader is the header containing the encrypted signature of the forwarded request
+	RouteServiceSignatureHeader = "X-CF-Proxy-Signature"
+	// RouteServiceMetadataHeader is the header containing the metadata needed to decrypt the signature
+	RouteServiceMetadataHeader = "X-CF-Proxy-Metadata"
+)
+
+// RouteServiceSignature is the content of the route service signature header
+type RouteServiceSignature struct {
+	RequestedTime time.Time `json:"requested_time"`
+	ForwardedURL  string    `json:"forwarded_url"`
+}
+
+type routeServiceMetadata struct {
+	Nonce []byte `json:"nonce"`
+}
+
+// RouteServiceSigner signs the requests sent to the route services, and validates them
+// when they come back, as gorouter does. Signatures are encrypted with AES-GCM.
+type RouteServiceSigner struct {
+	aead cipher.AEAD
+	// Timeout is how long a signature is valid
+	Timeout time.Duration
+}
+
+// NewRouteServiceSigner returns a RouteServiceSigner with a key derived from the secret.
+// If the secret is empty a random key is used, and only this process can validate the signatures.
+func NewRouteServiceSigner(secret string, timeout time.Duration) (*RouteServiceSigner, error) {
+	if secret == "" {
+		random := make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, random); err != nil {
+			return nil, err
+		}
+		secret = string(random)
+	}
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &RouteServiceSigner{aead: aead, Timeout: timeout}, nil
+}
+
+// Sign returns the signature and metadata headers of a request forwarded to a route service
+func (s *RouteServiceSigner) Sign(forwardedURL string) (signature, metadata string, err error) {
+	plain, err := json.Marshal(RouteServiceSignature{RequestedTime: time.Now().UTC(), ForwardedURL: forwardedURL})
+	if err != nil {
+		return "", "", err
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", "", err
+	}
+	meta, err := json.Marshal(routeServiceMetadata{Nonce: nonce})
+	if err != nil {
+		return "", "", err
+	}
+	return base64.URLEncoding.EncodeToString(s.aead.Seal(nil, nonce, plain, nil)),
+		base64.URLEncoding.EncodeToString(meta), nil
+}
+
+// Validate checks the signature of a request coming back from a route service
+// for the requested URL
+func (s *RouteServiceSigner) Validate(signature, metadata, requestedURL string) error {
+	if signature == "" || metadata == "" {
+		return errors.New("missing route service signature")
+	}
+	data, err := base64.URLEncoding.DecodeString(metadata)
+	if err != nil {
+		return err
+	}
+	var meta routeServiceMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return err
+	}
+	if len(meta.Nonce) != s.aead.NonceSize() {
+		return errors.New("invalid route service metadata")
+	}
+	sealed, err := base64.URLEncoding.DecodeString(signature)
+	if err != nil {
+		return err
+	}
+	plain, err := s.aead.Open(nil, meta.Nonce, sealed, nil)
+	if err != nil {
+		return errors.New("invalid route service signature")
+	}
+
+	var sig RouteServiceSignature
+	if err := json.Unmarshal(plain, &sig); err != nil {
+		return err
+	}
+	if time.Since(sig.RequestedTime) > s.Timeout {
+		return errors.New("route service signature expired")
+	}
+	if sig.ForwardedURL != requestedURL {
+		return errors.New("route service signature doesn't match the requested URL")
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package ingress_test
+
+import (
+	"time"
+
+	. "github.com/mudler/eirini-ingress/extensions/ingress"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Route service signer", func() {
+	var signer *RouteServiceSigner
+
+	BeforeEach(func() {
+		var err error
+		signer, err = NewRouteServiceSigner("secret", time.Minute)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("validates its own signatures for the forwarded URL", func() {
+		signature, metadata, err := signer.Sign("https://foo.example.com/path?q=1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(signer.Validate(signature, metadata, "https://foo.example.com/path?q=1")).To(Succeed())
+		Expect(signer.Validate(signature, metadata, "https://foo.example.com/other")).ToNot(Succeed())
+		Expect(signer.Validate("", metadata, "https://foo.example.com/path?q=1")).ToNot(Succeed())
+	})
+
+	It("rejects signatures with another key or expired", func() {
+		signature, metadata, err := signer.Sign("https://foo.example.com/")
+		Expect(err).ToNot(HaveOccurred())
+
+		other, err := NewRouteServiceSigner("other", time.Minute)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(other.Validate(signature, metadata, "https://foo.example.com/")).ToNot(Succeed())
+
+		signer.Timeout = -time.Second
+		Expect(signer.Validate(signature, metadata, "https://foo.example.com/")).To(MatchError("route service signature expired"))
+	})
+})
@@ -0,0 +1,132 @@
+package ingress
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// RouteStatus is a route of an Eirini app, with the state of the resources generated for it
+type RouteStatus struct {
+	RouteEntry
+	ServiceExists bool `json:"service_exists"`
+	IngressExists bool `json:"ingress_exists"`
+	// TLSSecret is the secret the ingress uses for the hostname, if any
+	TLSSecret string `json:"tls_secret,omitempty"`
+	// HasAddress is true once the ingress controller assigned an address to the ingress
+	HasAddress bool `json:"has_address"`
+}
+
+// routeTable returns a route table filled with the pods of the namespace
+func (pw *PodWatcher) routeTable(client kubernetes.Interface, namespace string) (*RouteTable, error) {
+	pods, err := client.CoreV1().Pods(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	routes := NewRouteTable()
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		app := pw.GetRouteHandler(pod)
+		if !app.Validate() {
+			continue
+		}
+		eiriniApp := NewEiriniApp(pod)
+		eiriniApp.SetRouteServices(pw.RouteServices)
+		routes.Update(eiriniApp, pod, pw.DesiredService(app).GetName(), pw.DesiredIngress(app).GetName())
+	}
+	return routes, nil
+}
+
+// routeStatuses looks up the resources of the route entries
+func routeStatuses(client kubernetes.Interface, entries []RouteEntry) ([]RouteStatus, error) {
+	services := map[string]*corev1.Service{}
+	ingresses := map[string]*v1beta1.Ingress{}
+	statuses := []RouteStatus{}
+	for _, e := range entries {
+		key := e.Namespace + "/" + e.Service
+		svc, ok := services[key]
+		if !ok {
+			var err error
+			svc, err = client.CoreV1().Services(e.Namespace).Get(e.Service, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				svc = nil
+			} else if err != nil {
+				return nil, err
+			}
+			services[key] = svc
+		}
+
+		key = e.Namespace + "/" + e.Ingress
+		in, ok := ingresses[key]
+		if !ok {
+			var err error
+			in, err = client.ExtensionsV1beta1().Ingresses(e.Namespace).Get(e.Ingress, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				in = nil
+			} else if err != nil {
+				return nil, err
+			}
+			ingresses[key] = in
+		}
+
+		status := RouteStatus{RouteEntry: e, ServiceExists: svc != nil, IngressExists: in != nil}
+		if in != nil {
+			status.HasAddress = len(in.Status.LoadBalancer.Ingress) != 0
+			for _, t := range in.Spec.TLS {
+				if containsString(t.Hosts, e.Hostname) {
+					status.TLSSecret = t.SecretName
+					break
+				}
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// RouteStatuses returns the routes of the apps running in the namespace, sorted by hostname and port
+func (pw *PodWatcher) RouteStatuses(client kubernetes.Interface, namespace string) ([]RouteStatus, error) {
+	routes, err := pw.routeTable(client, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return routeStatuses(client, routes.Routes())
+}
+
+// RouteStatus returns the routes of the app serving the hostname in the namespace, matching
+// wildcard routes as the route table does. It returns false if no app serves the hostname.
+func (pw *PodWatcher) RouteStatus(client kubernetes.Interface, namespace, hostname string) ([]RouteStatus, bool, error) {
+	routes, err := pw.routeTable(client, namespace)
+	if err != nil {
+		return nil, false, err
+	}
+	app, ok := routes.Lookup(hostname)
+	if !ok {
+		return nil, false, nil
+	}
+
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	wildcard := ""
+	if i := strings.Index(hostname, "."); i != -1 {
+		wildcard = "*" + hostname[i:]
+	}
+	exact, wildcards := []RouteEntry{}, []RouteEntry{}
+	for _, e := range app.Entries() {
+		switch strings.ToLower(e.Hostname) {
+		case hostname:
+			exact = append(exact, e)
+		case wildcard:
+			wildcards = append(wildcards, e)
+		}
+	}
+	entries := exact
+	if len(entries) == 0 {
+		entries = wildcards
+	}
+	statuses, err := routeStatuses(client, entries)
+	return statuses, true, err
+}
@@ -0,0 +1,82 @@
+package ingress_test
+
+import (
+	. "github.com/mudler/eirini-ingress/extensions/ingress"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Route status", func() {
+	var (
+		pw     *PodWatcher
+		client *fake.Clientset
+	)
+
+	BeforeEach(func() {
+		pw = NewPodWatcher(nil, nil)
+		pw.TLS = true
+		notReady := appPod("foo", "foo-guid", "1", `[{"hostname":"foo.example.com","port":8080}]`)
+		notReady.Status.Conditions = nil
+		client = fake.NewSimpleClientset(
+			appPod("foo", "foo-guid", "0", `[{"hostname":"foo.example.com","port":8080}]`),
+			notReady,
+			appPod("bar", "bar-guid", "0", `[{"hostname":"bar.example.com","port":8080},{"hostname":"*.wild.example.com","port":8080}]`),
+		)
+		changes, err := pw.Plan(client, "eirini")
+		Expect(err).ToNot(HaveOccurred())
+		// Only the resources of foo exist
+		applied := []Change{}
+		for _, c := range changes {
+			if c.Name == "foo" {
+				applied = append(applied, c)
+			}
+		}
+		Expect(pw.Apply(client, applied)).To(BeEmpty())
+
+		in, err := client.ExtensionsV1beta1().Ingresses("eirini").Get("foo", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		in.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "1.2.3.4"}}
+		_, err = client.ExtensionsV1beta1().Ingresses("eirini").UpdateStatus(in)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("lists the routes with the state of their resources", func() {
+		statuses, err := pw.RouteStatuses(client, "eirini")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(statuses).To(HaveLen(3))
+		Expect(statuses[0].Hostname).To(Equal("*.wild.example.com"))
+		Expect(statuses[0].ServiceExists).To(BeFalse())
+		Expect(statuses[0].IngressExists).To(BeFalse())
+
+		foo := statuses[2]
+		Expect(foo.Hostname).To(Equal("foo.example.com"))
+		Expect(foo.GUID).To(Equal("foo-guid"))
+		Expect(foo.Instances).To(Equal(2))
+		Expect(foo.Ready).To(Equal(1))
+		Expect(foo.ServiceExists).To(BeTrue())
+		Expect(foo.IngressExists).To(BeTrue())
+		Expect(foo.TLSSecret).To(Equal("foo-tls"))
+		Expect(foo.HasAddress).To(BeTrue())
+	})
+
+	It("gets the routes of a hostname, matching wildcards", func() {
+		statuses, ok, err := pw.RouteStatus(client, "eirini", "FOO.example.com")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(statuses).To(HaveLen(1))
+		Expect(statuses[0].App).To(Equal("foo"))
+
+		statuses, ok, err = pw.RouteStatus(client, "eirini", "x.wild.example.com")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(statuses).To(HaveLen(1))
+		Expect(statuses[0].Hostname).To(Equal("*.wild.example.com"))
+
+		_, ok, err = pw.RouteStatus(client, "eirini", "unknown.example.com")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ok).To(BeFalse())
+	})
+})
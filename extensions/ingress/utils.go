@@ -6,6 +6,7 @@ import (
 
 	eirinix "github.com/SUSE/eirinix"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -22,6 +23,14 @@ func getClientSet(manager eirinix.Manager) (clientset *kubernetes.Clientset, err
 	return
 }
 
+func getDynamicClient(manager eirinix.Manager) (dynamic.Interface, error) {
+	config, err := manager.GetKubeConnection()
+	if err != nil {
+		return nil, err
+	}
+	return dynamic.NewForConfig(config)
+}
+
 func getInstanceID(pod *corev1.Pod) string {
 	instanceID := "0"
 	el := strings.Split(pod.GetName(), "-")
@@ -34,3 +43,40 @@ func getInstanceID(pod *corev1.Pod) string {
 
 	return instanceID
 }
+
+// matchDomain checks if the hostname is covered by the domain and returns a score
+// which is higher for more specific domains.
+// A domain in the form `*.example.com` matches the hostnames one label below example.com,
+// as a wildcard certificate does, while a plain domain matches only the exact hostname,
+// which always wins over wildcards.
+func matchDomain(domain, hostname string) (int, bool) {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+
+	if strings.HasPrefix(domain, "*.") {
+		suffix := domain[1:]
+		if !strings.HasSuffix(hostname, suffix) || len(hostname) == len(suffix) {
+			return 0, false
+		}
+		if strings.Contains(hostname[:len(hostname)-len(suffix)], ".") {
+			return 0, false
+		}
+		return len(suffix), true
+	}
+
+	if domain == hostname {
+		// Wildcard suffixes are always shorter than the hostname,
+		// so exact matches win over them
+		return len(domain), true
+	}
+	return 0, false
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
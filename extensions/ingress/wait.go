@@ -0,0 +1,104 @@
+package ingress
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// AppReadiness is the state of the resources routing the traffic to an app
+type AppReadiness struct {
+	// Ready is true when the app is reachable through its ingress
+	Ready bool
+	// Reason explains why the app is not ready yet
+	Reason string
+	// Terminal is true if the app can't become ready without changing it, so waiting is pointless
+	Terminal bool
+	// Hostnames are the hostnames of the app, without the wildcards
+	Hostnames []string
+}
+
+// AppReadiness checks that the Service and Ingress of the app in the namespace exist, match their
+// desired state, and that the ingress controller assigned an address to the Ingress
+func (pw *PodWatcher) AppReadiness(client kubernetes.Interface, namespace, name string) (AppReadiness, error) {
+	pods, err := client.CoreV1().Pods(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return AppReadiness{}, err
+	}
+	var app RouteHandler
+	for i := range pods.Items {
+		if h := pw.GetRouteHandler(&pods.Items[i]); h.Validate() && NewEiriniApp(&pods.Items[i]).Name == name {
+			app = h
+			break
+		}
+	}
+	if app == nil {
+		return AppReadiness{Reason: fmt.Sprintf("no pods of the app %s in %s", name, namespace)}, nil
+	}
+
+	readiness := AppReadiness{}
+	desiredIngress := pw.DesiredIngress(app)
+	for _, r := range desiredIngress.Spec.Rules {
+		if !strings.HasPrefix(r.Host, "*") && !containsString(readiness.Hostnames, r.Host) {
+			readiness.Hostnames = append(readiness.Hostnames, r.Host)
+		}
+	}
+
+	if len(desiredIngress.Spec.Rules) == 0 {
+		readiness.Reason = fmt.Sprintf("all the routes of the app %s are bound to route services, which are not served by an ingress", name)
+		readiness.Terminal = true
+		return readiness, nil
+	}
+
+	desiredService := pw.DesiredService(app)
+	svc, err := client.CoreV1().Services(namespace).Get(desiredService.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		readiness.Reason = fmt.Sprintf("service %s doesn't exist", desiredService.GetName())
+		return readiness, nil
+	}
+	if err != nil {
+		return readiness, err
+	}
+	if _, fields := diffService(svc, desiredService); len(fields) != 0 {
+		readiness.Reason = fmt.Sprintf("service %s differs from the desired state in %s", svc.GetName(), fields[0].Path)
+		return readiness, nil
+	}
+
+	in, err := client.ExtensionsV1beta1().Ingresses(namespace).Get(desiredIngress.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		readiness.Reason = fmt.Sprintf("ingress %s doesn't exist", desiredIngress.GetName())
+		return readiness, nil
+	}
+	if err != nil {
+		return readiness, err
+	}
+	if _, fields := diffIngress(in, desiredIngress); len(fields) != 0 {
+		readiness.Reason = fmt.Sprintf("ingress %s differs from the desired state in %s", in.GetName(), fields[0].Path)
+		return readiness, nil
+	}
+	if len(in.Status.LoadBalancer.Ingress) == 0 {
+		readiness.Reason = fmt.Sprintf("ingress %s has no load balancer address", in.GetName())
+		return readiness, nil
+	}
+
+	readiness.Ready = true
+	return readiness, nil
+}
+
+// CheckHTTP sends a GET request to the hostname, and returns an error unless it gets a successful
+// or redirect response. The client should not follow redirects, which may lead out of the app.
+func CheckHTTP(client *http.Client, scheme, hostname string) error {
+	resp, err := client.Get(fmt.Sprintf("%s://%s/", scheme, hostname))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("GET %s://%s/ returned %s", scheme, hostname, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package ingress_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/mudler/eirini-ingress/extensions/ingress"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Wait", func() {
+	var (
+		pw     *PodWatcher
+		client *fake.Clientset
+	)
+
+	BeforeEach(func() {
+		pw = NewPodWatcher(nil, nil)
+		client = fake.NewSimpleClientset(
+			appPod("foo", "foo-guid", "0", `[{"hostname":"foo.example.com","port":8080},{"hostname":"*.foo.example.com","port":8080}]`),
+		)
+	})
+
+	readiness := func() AppReadiness {
+		r, err := pw.AppReadiness(client, "eirini", "foo")
+		Expect(err).ToNot(HaveOccurred())
+		return r
+	}
+
+	It("is ready once the resources exist, match and have an address", func() {
+		Expect(readiness()).To(Equal(AppReadiness{Reason: "service foo doesn't exist", Hostnames: []string{"foo.example.com"}}))
+
+		changes, err := pw.Plan(client, "eirini")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pw.Apply(client, changes[:1])).To(BeEmpty())
+		Expect(readiness().Reason).To(Equal("ingress foo doesn't exist"))
+
+		Expect(pw.Apply(client, changes[1:])).To(BeEmpty())
+		Expect(readiness().Reason).To(Equal("ingress foo has no load balancer address"))
+
+		in, err := client.ExtensionsV1beta1().Ingresses("eirini").Get("foo", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		in.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "1.2.3.4"}}
+		_, err = client.ExtensionsV1beta1().Ingresses("eirini").UpdateStatus(in)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(readiness()).To(Equal(AppReadiness{Ready: true, Hostnames: []string{"foo.example.com"}}))
+
+		pw.CustomLabels = map[string]string{"new": "label"}
+		Expect(readiness().Reason).To(Equal("service foo differs from the desired state in metadata.labels"))
+		Expect(readiness().Terminal).To(BeFalse())
+	})
+
+	It("reports the apps without pods", func() {
+		r, err := pw.AppReadiness(client, "eirini", "bar")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(r.Ready).To(BeFalse())
+		Expect(r.Reason).To(Equal("no pods of the app bar in eirini"))
+	})
+
+	It("never becomes ready when all the routes are bound to route services", func() {
+		client = fake.NewSimpleClientset(
+			appPod("foo", "foo-guid", "0", `[{"hostname":"foo.example.com","port":8080,"route_service_url":"https://rs.example.com"}]`),
+		)
+		r := readiness()
+		Expect(r.Ready).To(BeFalse())
+		Expect(r.Terminal).To(BeTrue())
+		Expect(r.Reason).To(Equal("all the routes of the app foo are bound to route services, which are not served by an ingress"))
+	})
+
+	It("checks the hostnames over HTTP", func() {
+		status := http.StatusOK
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Host).To(Equal("foo.example.com"))
+			w.WriteHeader(status)
+		}))
+		defer server.Close()
+		httpClient := &http.Client{
+			Transport: &http.Transport{
+				Dial: func(network, addr string) (net.Conn, error) {
+					return net.Dial(network, server.Listener.Addr().String())
+				},
+			},
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+
+		Expect(CheckHTTP(httpClient, "http", "foo.example.com")).To(Succeed())
+		status = http.StatusFound
+		Expect(CheckHTTP(httpClient, "http", "foo.example.com")).To(Succeed())
+		// e.g. the default backend of the ingress controller, before the app is routed
+		status = http.StatusNotFound
+		Expect(CheckHTTP(httpClient, "http", "foo.example.com")).To(MatchError("GET http://foo.example.com/ returned 404 Not Found"))
+		status = http.StatusBadGateway
+		Expect(CheckHTTP(httpClient, "http", "foo.example.com")).To(MatchError("GET http://foo.example.com/ returned 502 Bad Gateway"))
+	})
+})
@@ -0,0 +1,263 @@
+package ingress
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	eirinix "github.com/SUSE/eirinix"
+	api "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
+	listener "github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
+	route "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	hcm "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	xdscache "github.com/envoyproxy/go-control-plane/pkg/cache/v2"
+	xdsserver "github.com/envoyproxy/go-control-plane/pkg/server/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/grpc"
+)
+
+const (
+	// XDSListenerName is the name of the HTTP listener published to the proxies
+	XDSListenerName = "eirini-http"
+	// XDSRouteConfigName is the name of the route configuration published to the proxies
+	XDSRouteConfigName = "eirini-routes"
+)
+
+// XDSServer publishes the RouteTable to an Envoy fleet through the xDS APIs (LDS, RDS, CDS and EDS,
+// also served over ADS). Each route hostname is a virtual host, routing to a cluster for each app port
+// whose endpoints are the IPs of the ready instances. All the proxies get the same configuration.
+type XDSServer struct {
+	Routes *RouteTable
+	// ListenerPort is the port of the HTTP listener of the proxies
+	ListenerPort uint32
+
+	cache    xdscache.SnapshotCache
+	mu       sync.Mutex
+	version  int
+	snapshot xdscache.Snapshot
+}
+
+// xdsNodeGroup is the cache key shared by all the proxies
+type xdsNodeGroup struct{}
+
+func (xdsNodeGroup) ID(*core.Node) string { return "eirini" }
+
+// NewXDSServer returns an XDSServer for the route table
+func NewXDSServer(routes *RouteTable, listenerPort uint32) *XDSServer {
+	return &XDSServer{
+		Routes:       routes,
+		ListenerPort: listenerPort,
+		cache:        xdscache.NewSnapshotCache(true, xdsNodeGroup{}, nil),
+	}
+}
+
+// XDSClusterName returns the name of the cluster of the app port
+func XDSClusterName(namespace, app string, port int) string {
+	return fmt.Sprintf("%s/%s:%d", namespace, app, port)
+}
+
+// adsSource tells the proxies to fetch the dependent resources over the ADS stream
+func adsSource() *core.ConfigSource {
+	return &core.ConfigSource{ConfigSourceSpecifier: &core.ConfigSource_Ads{Ads: &core.AggregatedConfigSource{}}}
+}
+
+func socketAddress(address string, port uint32) *core.Address {
+	return &core.Address{
+		Address: &core.Address_SocketAddress{
+			SocketAddress: &core.SocketAddress{
+				Protocol:      core.SocketAddress_TCP,
+				Address:       address,
+				PortSpecifier: &core.SocketAddress_PortValue{PortValue: port},
+			},
+		},
+	}
+}
+
+// Resources returns the clusters, endpoints, route configuration and listener built from the route table
+func (s *XDSServer) Resources() (clusters, endpoints, routes, listeners []types.Resource, err error) {
+	vhosts := []*route.VirtualHost{}
+	apps := s.Routes.Apps()
+	owners := hostnameOwners(apps)
+	for _, app := range apps {
+		ports := map[int]interface{}{}
+		for _, r := range app.Routes {
+			// Envoy can't enforce route services, the routes bound to one are not served
+			if r.RouteServiceURL != "" {
+				continue
+			}
+			cluster := XDSClusterName(app.Namespace, app.Name, r.Port)
+			if _, ok := ports[r.Port]; !ok {
+				ports[r.Port] = nil
+				clusters = append(clusters, &api.Cluster{
+					Name:                 cluster,
+					ConnectTimeout:       ptypes.DurationProto(5 * time.Second),
+					ClusterDiscoveryType: &api.Cluster_Type{Type: api.Cluster_EDS},
+					EdsClusterConfig:     &api.Cluster_EdsClusterConfig{EdsConfig: adsSource()},
+				})
+
+				lbEndpoints := []*endpoint.LbEndpoint{}
+				for _, i := range sortedInstances(app) {
+					if !i.Ready || i.IP == "" {
+						continue
+					}
+					lbEndpoints = append(lbEndpoints, &endpoint.LbEndpoint{
+						HostIdentifier: &endpoint.LbEndpoint_Endpoint{
+							Endpoint: &endpoint.Endpoint{Address: socketAddress(i.IP, uint32(r.Port))},
+						},
+					})
+				}
+				endpoints = append(endpoints, &api.ClusterLoadAssignment{
+					ClusterName: cluster,
+					Endpoints:   []*endpoint.LocalityLbEndpoints{{LbEndpoints: lbEndpoints}},
+				})
+			}
+
+			// Envoy rejects duplicated domains, only the app serving a hostname gets it
+			hostname := strings.ToLower(r.Hostname)
+			if owners[hostname] != appKey(app.Namespace, app.Name) {
+				continue
+			}
+			owners[hostname] = ""
+			vhosts = append(vhosts, &route.VirtualHost{
+				Name:    hostname,
+				Domains: []string{hostname, hostname + ":" + strconv.Itoa(int(s.ListenerPort))},
+				Routes: []*route.Route{{
+					Match: &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/"}},
+					Action: &route.Route_Route{
+						Route: &route.RouteAction{ClusterSpecifier: &route.RouteAction_Cluster{Cluster: cluster}},
+					},
+				}},
+			})
+		}
+	}
+	routes = []types.Resource{&api.RouteConfiguration{Name: XDSRouteConfigName, VirtualHosts: vhosts}}
+
+	manager, err := ptypes.MarshalAny(&hcm.HttpConnectionManager{
+		CodecType:  hcm.HttpConnectionManager_AUTO,
+		StatPrefix: "eirini",
+		RouteSpecifier: &hcm.HttpConnectionManager_Rds{
+			Rds: &hcm.Rds{ConfigSource: adsSource(), RouteConfigName: XDSRouteConfigName},
+		},
+		HttpFilters: []*hcm.HttpFilter{{Name: wellknown.Router}},
+	})
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	listeners = []types.Resource{&api.Listener{
+		Name:    XDSListenerName,
+		Address: socketAddress("0.0.0.0", s.ListenerPort),
+		FilterChains: []*listener.FilterChain{{
+			Filters: []*listener.Filter{{
+				Name:       wellknown.HTTPConnectionManager,
+				ConfigType: &listener.Filter_TypedConfig{TypedConfig: manager},
+			}},
+		}},
+	}}
+	return clusters, endpoints, routes, listeners, nil
+}
+
+// Snapshot returns the configuration currently published to the proxies
+func (s *XDSServer) Snapshot() xdscache.Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshot
+}
+
+// Update publishes the current route table to the proxies. Only the resource types
+// which changed get a new version, so the proxies receive just the updated parts.
+func (s *XDSServer) Update() error {
+	clusters, endpoints, routes, listeners, err := s.Resources()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version++
+	version := strconv.Itoa(s.version)
+	next := xdscache.Snapshot{}
+	for typ, items := range map[types.ResponseType][]types.Resource{
+		types.Cluster:  clusters,
+		types.Endpoint: endpoints,
+		types.Route:    routes,
+		types.Listener: listeners,
+	} {
+		resources := xdscache.NewResources(version, items)
+		if previous := s.snapshot.Resources[typ]; previous.Version != "" && sameResources(previous.Items, resources.Items) {
+			resources = previous
+		}
+		next.Resources[typ] = resources
+	}
+	if err := next.Consistent(); err != nil {
+		return err
+	}
+	s.snapshot = next
+	return s.cache.SetSnapshot(xdsNodeGroup{}.ID(nil), next)
+}
+
+func sameResources(a, b map[string]types.Resource) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, r := range a {
+		other, ok := b[name]
+		if !ok || !proto.Equal(r, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// ListenAndServe serves xDS on the address, pushing a new configuration on every change of the route table,
+// including the addresses of the app instances.
+// It blocks until the server fails.
+func (s *XDSServer) ListenAndServe(manager eirinix.Manager, addr string) error {
+	events, cancel := s.Routes.Subscribe()
+	defer cancel()
+	if err := s.Update(); err != nil {
+		return err
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	server := xdsserver.NewServer(ctx, s.cache, nil)
+	grpcServer := grpc.NewServer()
+	discovery.RegisterAggregatedDiscoveryServiceServer(grpcServer, server)
+	api.RegisterListenerDiscoveryServiceServer(grpcServer, server)
+	api.RegisterRouteDiscoveryServiceServer(grpcServer, server)
+	api.RegisterClusterDiscoveryServiceServer(grpcServer, server)
+	api.RegisterEndpointDiscoveryServiceServer(grpcServer, server)
+
+	go func() {
+		for range events {
+			// Coalesce the events of a single change into one update
+			for drained := false; !drained; {
+				select {
+				case <-events:
+				default:
+					drained = true
+				}
+			}
+			if err := s.Update(); err != nil {
+				manager.GetLogger().Error(err.Error())
+			}
+		}
+	}()
+
+	return grpcServer.Serve(l)
+}
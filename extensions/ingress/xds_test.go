@@ -0,0 +1,79 @@
+package ingress_test
+
+import (
+	api "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	. "github.com/mudler/eirini-ingress/extensions/ingress"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("xDS server", func() {
+	var (
+		routes *RouteTable
+		xds    *XDSServer
+	)
+
+	BeforeEach(func() {
+		routes = NewRouteTable()
+		for _, pod := range []*corev1.Pod{
+			appPod("foo", "foo-guid", "0", `[{"hostname":"foo.example.com","port":8080}]`),
+			appPod("foo", "foo-guid", "1", `[{"hostname":"foo.example.com","port":8080},{"hostname":"auth.example.com","port":8080,"route_service_url":"https://rs.example.com"}]`),
+		} {
+			routes.Update(NewEiriniApp(pod), pod, "foo", "foo")
+		}
+		xds = NewXDSServer(routes, 8080)
+	})
+
+	It("publishes a virtual host per hostname and the ready instances as endpoints", func() {
+		Expect(xds.Update()).To(Succeed())
+		snapshot := xds.Snapshot()
+		Expect(snapshot.Consistent()).To(Succeed())
+
+		Expect(snapshot.Resources[types.Cluster].Items).To(HaveKey("eirini/foo:8080"))
+		assignment := snapshot.Resources[types.Endpoint].Items["eirini/foo:8080"].(*api.ClusterLoadAssignment)
+		Expect(assignment.Endpoints[0].LbEndpoints).To(HaveLen(2))
+		Expect(assignment.Endpoints[0].LbEndpoints[0].GetEndpoint().Address.GetSocketAddress().Address).To(Equal("10.1.0.0"))
+
+		config := snapshot.Resources[types.Route].Items[XDSRouteConfigName].(*api.RouteConfiguration)
+		Expect(config.VirtualHosts).To(HaveLen(1))
+		Expect(config.VirtualHosts[0].Domains).To(ContainElement("foo.example.com"))
+		Expect(config.VirtualHosts[0].Routes[0].GetRoute().GetCluster()).To(Equal("eirini/foo:8080"))
+		Expect(snapshot.Resources[types.Listener].Items).To(HaveKey(XDSListenerName))
+	})
+
+	It("versions only the resources which changed", func() {
+		Expect(xds.Update()).To(Succeed())
+		before := xds.Snapshot()
+
+		pod := appPod("foo", "foo-guid", "1", `[{"hostname":"foo.example.com","port":8080}]`)
+		pod.Status.Conditions[0].Status = corev1.ConditionFalse
+		routes.Update(NewEiriniApp(pod), pod, "foo", "foo")
+		Expect(xds.Update()).To(Succeed())
+		after := xds.Snapshot()
+
+		Expect(after.Resources[types.Endpoint].Version).ToNot(Equal(before.Resources[types.Endpoint].Version))
+		Expect(after.Resources[types.Cluster].Version).To(Equal(before.Resources[types.Cluster].Version))
+		Expect(after.Resources[types.Route].Version).To(Equal(before.Resources[types.Route].Version))
+		assignment := after.Resources[types.Endpoint].Items["eirini/foo:8080"].(*api.ClusterLoadAssignment)
+		Expect(assignment.Endpoints[0].LbEndpoints).To(HaveLen(1))
+	})
+
+	It("pushes the new addresses of the instances", func() {
+		events, cancel := routes.Subscribe()
+		defer cancel()
+
+		pod := appPod("foo", "foo-guid", "1", `[{"hostname":"foo.example.com","port":8080}]`)
+		pod.Status.PodIP = "10.1.0.42"
+		routes.Update(NewEiriniApp(pod), pod, "foo", "foo")
+		Expect(events).To(Receive(Equal(RouteEvent{Type: RouteUpdated, Route: RouteEntry{
+			Hostname: "foo.example.com", Port: 8080, App: "foo", GUID: "foo-guid", Namespace: "eirini",
+			Instances: 2, Ready: 2, Service: "foo", Ingress: "foo",
+		}})))
+
+		Expect(xds.Update()).To(Succeed())
+		assignment := xds.Snapshot().Resources[types.Endpoint].Items["eirini/foo:8080"].(*api.ClusterLoadAssignment)
+		Expect(assignment.Endpoints[0].LbEndpoints[1].GetEndpoint().Address.GetSocketAddress().Address).To(Equal("10.1.0.42"))
+	})
+})